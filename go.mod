@@ -1,3 +1,8 @@
 module github.com/limedriveku/limesub_app
 
 go 1.21
+
+require (
+	golang.org/x/sys v0.20.0
+	golang.org/x/text v0.14.0
+)
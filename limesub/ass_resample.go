@@ -0,0 +1,536 @@
+package limesub
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ====================== ASS RESAMPLE ======================
+
+const (
+	resampleTargetX = 1920
+	resampleTargetY = 1080
+	resampleFont    = defaultFont
+)
+
+// assSection is one "[Name]" block of an ASS script, header line excluded.
+type assSection struct {
+	Name  string
+	Lines []string
+}
+
+// ResampleASSFileTo1080 is ResampleASSFile with a 1920x1080 target.
+func ResampleASSFileTo1080(inputPath, outputPath string, opts Options) error {
+	return ResampleASSFile(inputPath, outputPath, resampleTargetX, resampleTargetY, opts)
+}
+
+// ResampleASSFile normalizes an existing ASS script to targetX x targetY with
+// the Limenime font, scaling styles, margins and override tags from the source
+// PlayRes (or opts.SourceRes when set).
+func ResampleASSFile(inputPath, outputPath string, targetX, targetY int, opts Options) error {
+	if err := refuseOverwrite(inputPath, outputPath); err != nil {
+		return err
+	}
+	data, err := readTextFile(inputPath, opts)
+	if err != nil {
+		return err
+	}
+	out, err := resampleASS(data, targetX, targetY, opts)
+	if err != nil {
+		return err
+	}
+	return writeOutput(outputPath, out, opts)
+}
+
+func resampleASS(data string, targetX, targetY int, opts Options) (string, error) {
+	if targetX <= 0 || targetY <= 0 {
+		targetX, targetY = resampleTargetX, resampleTargetY
+	}
+	data = strings.TrimPrefix(strings.ReplaceAll(data, "\r", ""), "\ufeff")
+	preamble, sections := splitASSSections(data)
+	sections, err := mergeDuplicateSections(sections)
+	if err != nil {
+		return "", err
+	}
+
+	info := findSection(sections, "Script Info")
+	if info == nil {
+		return "", fmt.Errorf("bukan file ASS yang valid: section [Script Info] tidak ditemukan")
+	}
+	srcX, srcY := readPlayRes(info.Lines)
+	if opts.SourceRes != "" {
+		// header PlayRes doesn't match what the tags were authored against
+		x, y, err := parseResolution(opts.SourceRes)
+		if err != nil {
+			return "", err
+		}
+		srcX, srcY = x, y
+	}
+	sc := newResampleScale(srcX, srcY, targetX, targetY, opts.ResampleMode)
+	if !opts.KeepFonts {
+		sc.font = resampleFont
+	}
+
+	info.Lines = updateOrInsertPlayRes(info.Lines, targetX, targetY)
+	info.Lines = insertResampleComment(info.Lines, srcX, srcY, targetX, targetY)
+
+	if st := findSection(sections, "V4+ Styles"); st != nil {
+		st.Lines = rescaleStyleMargins(st.Lines, sc)
+	}
+	if ev := findSection(sections, "Events"); ev != nil {
+		ev.Lines = rescaleEvents(ev.Lines, sc)
+	}
+
+	var buf strings.Builder
+	for _, l := range preamble {
+		buf.WriteString(l + "\n")
+	}
+	for _, s := range sections {
+		buf.WriteString("[" + s.Name + "]\n")
+		for _, l := range s.Lines {
+			buf.WriteString(l + "\n")
+		}
+	}
+	return buf.String(), nil
+}
+
+func splitASSSections(data string) ([]string, []assSection) {
+	var preamble []string
+	var sections []assSection
+	for _, line := range strings.Split(data, "\n") {
+		t := strings.TrimSpace(line)
+		if strings.HasPrefix(t, "[") && strings.HasSuffix(t, "]") {
+			sections = append(sections, assSection{Name: t[1 : len(t)-1]})
+			continue
+		}
+		if len(sections) == 0 {
+			if t != "" {
+				preamble = append(preamble, line)
+			}
+			continue
+		}
+		last := &sections[len(sections)-1]
+		last.Lines = append(last.Lines, line)
+	}
+	return preamble, sections
+}
+
+// mergeDuplicateSections folds repeated section headers (concatenated or
+// malformed scripts) into their first occurrence. Repeated Format lines must
+// match the first one, otherwise the columns can't be reconciled.
+func mergeDuplicateSections(sections []assSection) ([]assSection, error) {
+	var out []assSection
+	index := map[string]int{}
+	for _, s := range sections {
+		key := strings.ToLower(s.Name)
+		i, seen := index[key]
+		if !seen {
+			index[key] = len(out)
+			out = append(out, s)
+			continue
+		}
+		first := &out[i]
+		format := sectionFormat(first.Lines)
+		styles := map[string]bool{}
+		for _, l := range first.Lines {
+			if name, ok := styleName(l); ok {
+				styles[name] = true
+			}
+		}
+		first.Lines = trimTrailingBlank(first.Lines)
+		for _, l := range s.Lines {
+			if strings.HasPrefix(l, "Format:") {
+				if format != "" && normalizeFormat(l) != format {
+					return nil, fmt.Errorf("section [%s] muncul lebih dari sekali dengan Format berbeda", s.Name)
+				}
+				continue
+			}
+			if name, ok := styleName(l); ok {
+				if styles[name] {
+					continue
+				}
+				styles[name] = true
+			}
+			first.Lines = append(first.Lines, l)
+		}
+	}
+	return out, nil
+}
+
+func findSection(sections []assSection, name string) *assSection {
+	for i := range sections {
+		if strings.EqualFold(sections[i].Name, name) {
+			return &sections[i]
+		}
+	}
+	return nil
+}
+
+func sectionFormat(lines []string) string {
+	for _, l := range lines {
+		if strings.HasPrefix(l, "Format:") {
+			return normalizeFormat(l)
+		}
+	}
+	return ""
+}
+
+func normalizeFormat(line string) string {
+	return strings.ToLower(strings.Join(strings.Fields(strings.TrimPrefix(line, "Format:")), ""))
+}
+
+func formatFields(lines []string) map[string]int {
+	idx := map[string]int{}
+	for _, l := range lines {
+		if strings.HasPrefix(l, "Format:") {
+			for i, name := range strings.Split(strings.TrimPrefix(l, "Format:"), ",") {
+				idx[strings.ToLower(strings.TrimSpace(name))] = i
+			}
+			break
+		}
+	}
+	return idx
+}
+
+func styleName(line string) (string, bool) {
+	if !strings.HasPrefix(line, "Style:") {
+		return "", false
+	}
+	name := strings.SplitN(strings.TrimPrefix(line, "Style:"), ",", 2)[0]
+	return strings.TrimSpace(name), true
+}
+
+func trimTrailingBlank(lines []string) []string {
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// readPlayRes returns the script resolution, falling back to the ASS default
+// 384x288 (and a 4:3 partner when only one of the two is set).
+func readPlayRes(lines []string) (int, int) {
+	x, y := 0, 0
+	for _, l := range lines {
+		if v, ok := infoValue(l, "PlayResX"); ok {
+			x, _ = strconv.Atoi(v)
+		}
+		if v, ok := infoValue(l, "PlayResY"); ok {
+			y, _ = strconv.Atoi(v)
+		}
+	}
+	switch {
+	case x <= 0 && y <= 0:
+		x, y = 384, 288
+	case x <= 0:
+		x = y * 4 / 3
+	case y <= 0:
+		y = x * 3 / 4
+	}
+	return x, y
+}
+
+// parseResolution parses "WxH" (e.g. "1280x720").
+func parseResolution(s string) (int, int, error) {
+	w, h, ok := strings.Cut(strings.ToLower(strings.TrimSpace(s)), "x")
+	x, errX := strconv.Atoi(w)
+	y, errY := strconv.Atoi(h)
+	if !ok || errX != nil || errY != nil || x <= 0 || y <= 0 {
+		return 0, 0, fmt.Errorf("resolusi tidak valid: %q (contoh: 1280x720)", s)
+	}
+	return x, y, nil
+}
+
+func infoValue(line, key string) (string, bool) {
+	k, v, ok := strings.Cut(line, ":")
+	if !ok || !strings.EqualFold(strings.TrimSpace(k), key) {
+		return "", false
+	}
+	return strings.TrimSpace(v), true
+}
+
+func updateOrInsertPlayRes(lines []string, x, y int) []string {
+	var out []string
+	for _, l := range lines {
+		if _, ok := infoValue(l, "PlayResX"); ok {
+			continue
+		}
+		if _, ok := infoValue(l, "PlayResY"); ok {
+			continue
+		}
+		out = append(out, l)
+	}
+	out = trimTrailingBlank(out)
+	out = append(out, fmt.Sprintf("PlayResX: %d", x), fmt.Sprintf("PlayResY: %d", y), "")
+	return out
+}
+
+func insertResampleComment(lines []string, srcX, srcY, dstX, dstY int) []string {
+	comment := fmt.Sprintf("; Resampled by Limesub v3 from %dx%d to %dx%d", srcX, srcY, dstX, dstY)
+	out := []string{comment}
+	for _, l := range lines {
+		if strings.HasPrefix(l, "; Resampled by Limesub") {
+			continue
+		}
+		out = append(out, l)
+	}
+	return out
+}
+
+// resampleScale maps source script coordinates onto the target resolution.
+// In letterbox mode both axes share one factor and the picture is centred,
+// so absolute positions also get offX/offY added.
+type resampleScale struct {
+	fx, fy, f  float64 // horizontal, vertical and size factors
+	offX, offY float64
+	font       string // "" keeps the original fonts
+}
+
+func newResampleScale(srcX, srcY, dstX, dstY int, mode string) resampleScale {
+	fx := float64(dstX) / float64(srcX)
+	fy := float64(dstY) / float64(srcY)
+	if mode != "letterbox" || fx == fy {
+		return resampleScale{fx: fx, fy: fy, f: (fx + fy) / 2}
+	}
+	s := math.Min(fx, fy)
+	return resampleScale{
+		fx: s, fy: s, f: s,
+		offX: (float64(dstX) - float64(srcX)*s) / 2,
+		offY: (float64(dstY) - float64(srcY)*s) / 2,
+	}
+}
+
+// x and y convert an absolute coordinate.
+func (sc resampleScale) x(v string) string { return scaleOffset(v, sc.fx, sc.offX) }
+func (sc resampleScale) y(v string) string { return scaleOffset(v, sc.fy, sc.offY) }
+
+// rescaleStyleMargins scales the size and margin fields of every Style line
+// and sets its font name to sc.font ("" keeps the original).
+func rescaleStyleMargins(lines []string, sc resampleScale) []string {
+	idx := formatFields(lines)
+	out := make([]string, 0, len(lines))
+	for _, l := range lines {
+		if !strings.HasPrefix(l, "Style:") {
+			out = append(out, l)
+			continue
+		}
+		fields := strings.Split(strings.TrimPrefix(l, "Style:"), ",")
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+		if i, ok := idx["fontname"]; ok && i < len(fields) && sc.font != "" {
+			fields[i] = sc.font
+		}
+		scaleField(fields, idx, "fontsize", sc.f)
+		scaleField(fields, idx, "spacing", sc.fx)
+		scaleField(fields, idx, "outline", sc.f)
+		scaleField(fields, idx, "shadow", sc.f)
+		scaleMargin(fields, idx, "marginl", sc.fx, sc.offX)
+		scaleMargin(fields, idx, "marginr", sc.fx, sc.offX)
+		scaleMargin(fields, idx, "marginv", sc.fy, sc.offY)
+		out = append(out, "Style: "+strings.Join(fields, ","))
+	}
+	return out
+}
+
+func rescaleEvents(lines []string, sc resampleScale) []string {
+	idx := formatFields(lines)
+	n := len(idx)
+	out := make([]string, 0, len(lines))
+	for _, l := range lines {
+		kind, rest, ok := strings.Cut(l, ":")
+		if !ok || (kind != "Dialogue" && kind != "Comment") || n == 0 {
+			out = append(out, l)
+			continue
+		}
+		fields := strings.SplitN(strings.TrimPrefix(rest, " "), ",", n)
+		if len(fields) < n {
+			out = append(out, l)
+			continue
+		}
+		// 0 means "use the style margin" and has to stay 0
+		if !isZeroField(fields, idx, "marginl") {
+			scaleMargin(fields, idx, "marginl", sc.fx, sc.offX)
+		}
+		if !isZeroField(fields, idx, "marginr") {
+			scaleMargin(fields, idx, "marginr", sc.fx, sc.offX)
+		}
+		if !isZeroField(fields, idx, "marginv") {
+			scaleMargin(fields, idx, "marginv", sc.fy, sc.offY)
+		}
+		if i, ok := idx["text"]; ok {
+			fields[i] = rescaleDialogueTags(fields[i], sc)
+		}
+		out = append(out, kind+": "+strings.Join(fields, ","))
+	}
+	return out
+}
+
+func scaleField(fields []string, idx map[string]int, name string, factor float64) {
+	i, ok := idx[name]
+	if !ok || i >= len(fields) {
+		return
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(fields[i]), 64)
+	if err != nil {
+		return
+	}
+	fields[i] = fmtNum(v * factor)
+}
+
+// scaleMargin scales an integer margin field and adds the letterbox offset.
+func scaleMargin(fields []string, idx map[string]int, name string, factor, off float64) {
+	i, ok := idx[name]
+	if !ok || i >= len(fields) {
+		return
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(fields[i]), 64)
+	if err != nil {
+		return
+	}
+	fields[i] = strconv.Itoa(int(math.Round(v*factor + off)))
+}
+
+func isZeroField(fields []string, idx map[string]int, name string) bool {
+	i, ok := idx[name]
+	if !ok || i >= len(fields) {
+		return false
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(fields[i]), 64)
+	return err == nil && v == 0
+}
+
+var (
+	reOverrideBlock = regexp.MustCompile(`\{[^}]*\}`)
+	rePosTag        = regexp.MustCompile(`\\(pos|org)\(\s*(-?[\d.]+)\s*,\s*(-?[\d.]+)\s*\)`)
+	reMoveTag       = regexp.MustCompile(`\\move\(\s*(-?[\d.]+)\s*,\s*(-?[\d.]+)\s*,\s*(-?[\d.]+)\s*,\s*(-?[\d.]+)`)
+	reClipRectTag   = regexp.MustCompile(`\\(i?clip)\(\s*(-?[\d.]+)\s*,\s*(-?[\d.]+)\s*,\s*(-?[\d.]+)\s*,\s*(-?[\d.]+)\s*\)`)
+	reClipVecTag    = regexp.MustCompile(`\\(i?clip)\(\s*(?:(\d+)\s*,\s*)?([mnlbspc][^)]*)\)`)
+	reDrawModeTag   = regexp.MustCompile(`\\p(\d+)`)
+	reSizeTag       = regexp.MustCompile(`\\(fs|[xy]?bord|[xy]?shad)(-?[\d.]+)`)
+	reSpacingTag    = regexp.MustCompile(`\\fsp(-?[\d.]+)`)
+	reFontTag       = regexp.MustCompile(`\\fn[^\\}]*`)
+)
+
+// rescaleDialogueTags scales positional and size override tags inside {...}
+// blocks. Plain dialogue text is left untouched, except while a \p1+ drawing
+// is active, where the text is a vector path and its coordinates are scaled.
+// Tags are matched wherever they sit in the block, so animation targets such
+// as \t(0,500,\clip(...)) are scaled too while \t's own timing arguments are
+// not. Colour and alpha tags (\c, \1c..\4c, \alpha, \1a..\4a) hold hex
+// values, not pixels, and must never match any of the patterns above. \fn is
+// set to font unless it is "".
+func rescaleDialogueTags(text string, sc resampleScale) string {
+	var sb strings.Builder
+	drawing := false
+	last := 0
+	for _, loc := range reOverrideBlock.FindAllStringIndex(text, -1) {
+		sb.WriteString(rescaleTextSegment(text[last:loc[0]], drawing, sc))
+		block := text[loc[0]:loc[1]]
+		for _, m := range reDrawModeTag.FindAllStringSubmatch(block, -1) {
+			drawing = m[1] != "0"
+		}
+		sb.WriteString(rescaleOverrideBlock(block, sc))
+		last = loc[1]
+	}
+	sb.WriteString(rescaleTextSegment(text[last:], drawing, sc))
+	return sb.String()
+}
+
+func rescaleTextSegment(s string, drawing bool, sc resampleScale) string {
+	if !drawing {
+		return s
+	}
+	// \p paths are relative to the line's position: scale, don't offset
+	return scaleDrawing(s, sc.fx, sc.fy, 0, 0)
+}
+
+func rescaleOverrideBlock(block string, sc resampleScale) string {
+	block = rePosTag.ReplaceAllStringFunc(block, func(m string) string {
+		p := rePosTag.FindStringSubmatch(m)
+		return fmt.Sprintf("\\%s(%s,%s)", p[1], sc.x(p[2]), sc.y(p[3]))
+	})
+	block = reMoveTag.ReplaceAllStringFunc(block, func(m string) string {
+		p := reMoveTag.FindStringSubmatch(m)
+		return fmt.Sprintf("\\move(%s,%s,%s,%s", sc.x(p[1]), sc.y(p[2]), sc.x(p[3]), sc.y(p[4]))
+	})
+	block = reClipRectTag.ReplaceAllStringFunc(block, func(m string) string {
+		p := reClipRectTag.FindStringSubmatch(m)
+		return fmt.Sprintf("\\%s(%s,%s,%s,%s)", p[1], sc.x(p[2]), sc.y(p[3]), sc.x(p[4]), sc.y(p[5]))
+	})
+	block = reClipVecTag.ReplaceAllStringFunc(block, func(m string) string {
+		p := reClipVecTag.FindStringSubmatch(m)
+		if p[2] != "" {
+			// with a scale argument n, path units are 2^(n-1) pixels, so the
+			// pixel offset shrinks to offX/unit path units
+			n, _ := strconv.Atoi(p[2])
+			unit := math.Pow(2, math.Max(0, float64(n-1)))
+			return fmt.Sprintf("\\%s(%s,%s)", p[1], p[2], scaleDrawing(p[3], sc.fx, sc.fy, sc.offX/unit, sc.offY/unit))
+		}
+		return fmt.Sprintf("\\%s(%s)", p[1], scaleDrawing(p[3], sc.fx, sc.fy, sc.offX, sc.offY))
+	})
+	block = reSizeTag.ReplaceAllStringFunc(block, func(m string) string {
+		p := reSizeTag.FindStringSubmatch(m)
+		// \xbord/\xshad are horizontal and \ybord/\yshad vertical sizes
+		f := sc.f
+		switch p[1][0] {
+		case 'x':
+			f = sc.fx
+		case 'y':
+			f = sc.fy
+		}
+		return "\\" + p[1] + scaleNum(p[2], f)
+	})
+	// letter spacing is purely horizontal, so it follows fx rather than the
+	// averaged f (matters for non-uniform changes such as 4:3 -> 16:9)
+	block = reSpacingTag.ReplaceAllStringFunc(block, func(m string) string {
+		return "\\fsp" + scaleNum(reSpacingTag.FindStringSubmatch(m)[1], sc.fx)
+	})
+	if sc.font == "" {
+		return block
+	}
+	return reFontTag.ReplaceAllString(block, "\\fn"+sc.font)
+}
+
+// scaleDrawing scales an ASS drawing path ("m 0 0 l 100 0 100 50"): numbers
+// after each command letter are x,y pairs, shifted by ox/oy after scaling.
+func scaleDrawing(path string, fx, fy, ox, oy float64) string {
+	fields := strings.Fields(path)
+	x := true
+	for i, tok := range fields {
+		if _, err := strconv.ParseFloat(tok, 64); err != nil {
+			x = true // command letter
+			continue
+		}
+		if x {
+			fields[i] = scaleOffset(tok, fx, ox)
+		} else {
+			fields[i] = scaleOffset(tok, fy, oy)
+		}
+		x = !x
+	}
+	return strings.Join(fields, " ")
+}
+
+func scaleOffset(s string, factor, off float64) string {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return s
+	}
+	return fmtNum(v*factor + off)
+}
+
+func scaleNum(s string, factor float64) string {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return s
+	}
+	return fmtNum(v * factor)
+}
+
+func fmtNum(v float64) string {
+	return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+}
@@ -0,0 +1,204 @@
+package limesub
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestResampleDuplicateSections(t *testing.T) {
+	data, err := os.ReadFile("testdata/double_sections.ass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := resampleASS(string(data), 1920, 1080, Options{KeepFonts: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := map[string]int{
+		"[V4+ Styles]":             1,
+		"[Events]":                 1,
+		"Style: Default,Arial,72,": 1,
+		"Style: Sign,Arial,60,":    1,
+		"Format: Name,":            1,
+		"Format: Layer,":           1,
+		"Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,First part":               1,
+		"Dialogue: 0,0:00:03.00,0:00:04.00,Sign,,0,0,0,,{\\pos(960,150)}Second part": 1,
+	}
+	for s, n := range counts {
+		if got := strings.Count(out, s); got != n {
+			t.Errorf("%q appears %d times, want %d:\n%s", s, got, n, out)
+		}
+	}
+	if strings.Contains(out, ",99,") || strings.Contains(out, ",148.5,") {
+		t.Errorf("the repeated Default style should be dropped:\n%s", out)
+	}
+}
+
+func TestResampleDuplicateSectionsFormatMismatch(t *testing.T) {
+	in := "[Script Info]\nPlayResX: 1280\nPlayResY: 720\n\n" +
+		"[Events]\nFormat: Layer, Start, End, Style, Text\n\n" +
+		"[Events]\nFormat: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text\n"
+	if _, err := resampleASS(in, 1920, 1080, Options{}); err == nil {
+		t.Error("want an error for repeated sections with different Format lines")
+	}
+}
+
+func TestResampleSourceRes(t *testing.T) {
+	// header claims 1920x1080, but the \pos was authored against 640x360
+	in := "[Script Info]\nPlayResX: 1920\nPlayResY: 1080\n\n" +
+		"[Events]\nFormat: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text\n" +
+		"Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,{\\pos(320,180)}Centre\n"
+	tests := []struct {
+		name, sourceRes, want string
+	}{
+		{"header PlayRes", "", "{\\pos(320,180)}Centre"},
+		{"override", "640x360", "{\\pos(960,540)}Centre"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := resampleASS(in, 1920, 1080, Options{KeepFonts: true, SourceRes: tt.sourceRes})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(out, tt.want+"\n") {
+				t.Errorf("want %q in:\n%s", tt.want, out)
+			}
+		})
+	}
+	if _, err := resampleASS(in, 1920, 1080, Options{SourceRes: "640"}); err == nil {
+		t.Error("want an error for a malformed -source-res")
+	}
+}
+
+func TestRescaleSpacingUsesHorizontalFactor(t *testing.T) {
+	// 4:3 to 16:9 stretch: fx = 3, fy = 2.25, average 2.625
+	sc := newResampleScale(640, 480, 1920, 1080, "stretch")
+	tests := []struct{ in, want string }{
+		{"{\\fsp2}wide", "{\\fsp6}wide"},
+		{"{\\fsp-1.5}tight", "{\\fsp-4.5}tight"},
+		{"{\\t(\\fsp4)}grow", "{\\t(\\fsp12)}grow"},
+	}
+	for _, tt := range tests {
+		if got := rescaleDialogueTags(tt.in, sc); got != tt.want {
+			t.Errorf("rescaleDialogueTags(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRescalePerAxisBorderAndShadow(t *testing.T) {
+	// 4:3 to 16:9 stretch: fx = 3, fy = 2.25, average 2.625
+	sc := newResampleScale(640, 480, 1920, 1080, "stretch")
+	tests := []struct{ in, want string }{
+		{"{\\bord2\\shad2}both", "{\\bord5.25\\shad5.25}both"},
+		{"{\\xbord2\\ybord2}border", "{\\xbord6\\ybord4.5}border"},
+		{"{\\xshad-1\\yshad4}shadow", "{\\xshad-3\\yshad9}shadow"},
+		{"{\\t(\\xbord4)}grow", "{\\t(\\xbord12)}grow"},
+	}
+	for _, tt := range tests {
+		if got := rescaleDialogueTags(tt.in, sc); got != tt.want {
+			t.Errorf("rescaleDialogueTags(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRescaleClipInsideTransform(t *testing.T) {
+	sc := newResampleScale(1280, 720, 1920, 1080, "stretch")
+	tests := []struct{ in, want string }{
+		{"{\\t(0,500,\\clip(0,0,640,360))}wipe", "{\\t(0,500,\\clip(0,0,960,540))}wipe"},
+		{"{\\clip(0,0,100,100)\\t(200,800,0.5,\\iclip(10,20,30,40))}ease", "{\\clip(0,0,150,150)\\t(200,800,0.5,\\iclip(15,30,45,60))}ease"},
+		{"{\\t(0,1000,\\clip(m 0 0 l 100 0 100 100))}vector", "{\\t(0,1000,\\clip(m 0 0 l 150 0 150 150))}vector"},
+		{"{\\t(0,500,\\fs40\\clip(0,0,10,10))}both", "{\\t(0,500,\\fs60\\clip(0,0,15,15))}both"},
+	}
+	for _, tt := range tests {
+		if got := rescaleDialogueTags(tt.in, sc); got != tt.want {
+			t.Errorf("rescaleDialogueTags(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRescaleLeavesAlphaAndColour(t *testing.T) {
+	sc := newResampleScale(640, 360, 1920, 1080, "stretch")
+	tests := []string{
+		"{\\alpha&H80&\\1a&H00&\\2a&HFF&\\3a&H40&\\4a&H10&}fade",
+		"{\\c&H00FF00&\\1c&H123456&\\3c&H000000&\\4c&H808080&}colour",
+		"{\\t(0,500,\\alpha&HFF&\\1a&H20&)}animated",
+		"{\\1a&H44&}{\\4a&H22&}two blocks",
+	}
+	for _, in := range tests {
+		if got := rescaleDialogueTags(in, sc); got != in {
+			t.Errorf("rescaleDialogueTags(%q) = %q, want it unchanged", in, got)
+		}
+	}
+	mixed := "{\\pos(100,50)\\alpha&H80&\\fs20\\1a&H10&}x"
+	if got, want := rescaleDialogueTags(mixed, sc), "{\\pos(300,150)\\alpha&H80&\\fs60\\1a&H10&}x"; got != want {
+		t.Errorf("rescaleDialogueTags(%q) = %q, want %q", mixed, got, want)
+	}
+}
+
+func TestRescaleClipsAndDrawings(t *testing.T) {
+	// 4:3 to 16:9 stretch: fx = 3, fy = 2.25
+	sc := newResampleScale(640, 480, 1920, 1080, "stretch")
+	tests := []struct{ name, in, want string }{
+		{"rect clip", "{\\clip(10,20,330,240)}x", "{\\clip(30,45,990,540)}x"},
+		{"rect iclip", "{\\iclip(0,0,640,480)}x", "{\\iclip(0,0,1920,1080)}x"},
+		{"vector clip", "{\\clip(m 0 0 l 100 0 100 40 0 40)}x", "{\\clip(m 0 0 l 300 0 300 90 0 90)}x"},
+		{"vector clip with scale", "{\\clip(2,m 0 0 b 10 20 30 40 50 60)}x", "{\\clip(2,m 0 0 b 30 45 90 90 150 135)}x"},
+		{"vector iclip", "{\\iclip(m 8 8 l 16 8)}x", "{\\iclip(m 24 18 l 48 18)}x"},
+		{"drawing", "{\\p1}m 0 0 l 100 0 100 100{\\p0}", "{\\p1}m 0 0 l 300 0 300 225{\\p0}"},
+		{"text after drawing", "{\\p1}m 0 0 l 10 10{\\p0} 100 200", "{\\p1}m 0 0 l 30 22.5{\\p0} 100 200"},
+		{"text without drawing", "{\\b1}m 0 0 l 10 10", "{\\b1}m 0 0 l 10 10"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rescaleDialogueTags(tt.in, sc); got != tt.want {
+				t.Errorf("rescaleDialogueTags(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRescaleLetterbox(t *testing.T) {
+	// 4:3 into 16:9: one factor of 2.25, picture centred 240px from the left
+	sc := newResampleScale(640, 480, 1920, 1080, "letterbox")
+	tests := []struct{ name, in, want string }{
+		{"pos", "{\\pos(320,240)}x", "{\\pos(960,540)}x"},
+		{"org", "{\\org(0,0)\\frz10}x", "{\\org(240,0)\\frz10}x"},
+		{"move keeps timing", "{\\move(0,0,640,480,100,900)}x", "{\\move(240,0,1680,1080,100,900)}x"},
+		{"rect clip", "{\\clip(0,0,640,480)}x", "{\\clip(240,0,1680,1080)}x"},
+		{"vector clip", "{\\clip(m 0 0 l 640 0 640 480)}x", "{\\clip(m 240 0 l 1680 0 1680 1080)}x"},
+		// units of 2px: 320 units = 640px -> 1680px = 840 units
+		{"vector clip with scale", "{\\clip(2,m 0 0 l 320 0 320 240)}x", "{\\clip(2,m 120 0 l 840 0 840 540)}x"},
+		{"drawing is relative", "{\\pos(0,0)\\p1}m 0 0 l 100 100", "{\\pos(240,0)\\p1}m 0 0 l 225 225"},
+		{"sizes", "{\\fs20\\bord2\\fsp4}x", "{\\fs45\\bord4.5\\fsp9}x"},
+		{"clip inside \\t", "{\\t(0,500,\\clip(0,0,320,240))}x", "{\\t(0,500,\\clip(240,0,960,540))}x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rescaleDialogueTags(tt.in, sc); got != tt.want {
+				t.Errorf("rescaleDialogueTags(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResampleLetterboxStyles(t *testing.T) {
+	in := "[Script Info]\nPlayResX: 640\nPlayResY: 480\n\n[V4+ Styles]\n" +
+		"Format: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, OutlineColour, BackColour, Bold, Italic, Underline, StrikeOut, ScaleX, ScaleY, Spacing, Angle, BorderStyle, Outline, Shadow, Alignment, MarginL, MarginR, MarginV, Encoding\n" +
+		"Style: Default,Arial,40,&H00FFFFFF,&H000000FF,&H00000000,&H00000000,0,0,0,0,100,100,2,0,1,2,1,2,20,20,20,1\n"
+	tests := []struct{ mode, want string }{
+		{"stretch", "Style: Default,Arial,105,&H00FFFFFF,&H000000FF,&H00000000,&H00000000,0,0,0,0,100,100,6,0,1,5.25,2.63,2,60,60,45,1\n"},
+		{"letterbox", "Style: Default,Arial,90,&H00FFFFFF,&H000000FF,&H00000000,&H00000000,0,0,0,0,100,100,4.5,0,1,4.5,2.25,2,285,285,45,1\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			out, err := resampleASS(in, 1920, 1080, Options{KeepFonts: true, ResampleMode: tt.mode})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(out, tt.want) {
+				t.Errorf("want %q in:\n%s", tt.want, out)
+			}
+		})
+	}
+}
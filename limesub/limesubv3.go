@@ -0,0 +1,2225 @@
+// Package limesub converts SRT, VTT, SBV, SAMI, LRC, JSON, XML and TTML
+// subtitles to Limenime-styled ASS (or SRT/VTT) and resamples existing ASS
+// scripts. The limesubv3 command is a thin wrapper around Convert and
+// ProcessFile.
+package limesub
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// ====================== BASIC STRUCT ======================
+
+type SRTBlock struct {
+	Index int // SRT cue number, see RenumberBlocks
+	Start time.Duration
+	End   time.Duration
+	Text  string
+	Style string
+	Layer int
+	// EndGuessed marks an End filled in by a parser default, not read from the input.
+	EndGuessed bool
+	// Sources holds the 1-based positions in the input file of the blocks
+	// merged into this one, set by the parser before any reordering.
+	Sources []int
+}
+
+// Warning is a non-fatal problem found while reading an input file.
+type Warning struct {
+	Index int // 1-based block index, 0 when it concerns the whole file
+	Msg   string
+}
+
+func (w Warning) String() string {
+	if w.Index == 0 {
+		return w.Msg
+	}
+	return fmt.Sprintf("blok %d: %s", w.Index, w.Msg)
+}
+
+// warnList collects the warnings of one parse, so concurrent conversions
+// each get their own.
+type warnList []Warning
+
+func (w *warnList) add(index int, format string, args ...interface{}) {
+	*w = append(*w, Warning{Index: index, Msg: fmt.Sprintf(format, args...)})
+}
+
+// parseTime parses a block timestamp, recording a warning (and using 0)
+// when it can't be read.
+func (w *warnList) parseTime(index int, s string) time.Duration {
+	d, err := parseTime(s)
+	if err != nil {
+		w.add(index, "timestamp tidak valid: %q", s)
+	}
+	return d
+}
+
+// ====================== UTILITIES ======================
+
+var reFontSizeTag = regexp.MustCompile(`\\fn[^\\}]+|\\fs\d+`)
+
+// stripFontTags removes \fn and \fs from override blocks, dropping blocks
+// left empty so no stray "{}" reaches the output.
+func stripFontTags(s string) string {
+	return reTagBlock.ReplaceAllStringFunc(s, func(b string) string {
+		b = reFontSizeTag.ReplaceAllString(b, "")
+		if strings.TrimSpace(b[1:len(b)-1]) == "" {
+			return ""
+		}
+		return b
+	})
+}
+
+// visibleText is what a cue shows on screen: no override blocks and no
+// <b>/<i>/<s>/<u> tags.
+func visibleText(s string) string {
+	return strings.TrimSpace(plainText(reHTMLStyleTag.ReplaceAllString(s, "")))
+}
+
+func cleanText(s string) string {
+	s = strings.ReplaceAll(s, "\r", "")
+	s = strings.TrimSpace(s)
+	return s
+}
+
+var reMultiSpace = regexp.MustCompile(`[ \t]+`)
+
+// normalizeSpaces collapses runs of spaces/tabs, used when comparing texts.
+func normalizeSpaces(s string) string {
+	return strings.TrimSpace(reMultiSpace.ReplaceAllString(cleanText(s), " "))
+}
+
+// collapseSpaces collapses repeated spaces in the visible text only, leaving
+// {...} override blocks untouched.
+func collapseSpaces(s string) string {
+	var sb strings.Builder
+	last := 0
+	for _, loc := range reOverrideBlock.FindAllStringIndex(s, -1) {
+		sb.WriteString(reMultiSpace.ReplaceAllString(s[last:loc[0]], " "))
+		sb.WriteString(s[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	sb.WriteString(reMultiSpace.ReplaceAllString(s[last:], " "))
+	return sb.String()
+}
+
+// reCaseKeep matches what changeCase must not touch: override blocks and the
+// \N, \n and \h escapes, whose meaning depends on the letter's case.
+var reCaseKeep = regexp.MustCompile(`\{[^}]*\}|\\[Nnh]`)
+
+// changeCase upper- or lowercases the visible text of an ASS line for
+// -tanda-case; any other mode returns s as is.
+func changeCase(s, mode string) string {
+	var conv func(string) string
+	switch mode {
+	case "upper":
+		conv = strings.ToUpper
+	case "lower":
+		conv = strings.ToLower
+	default:
+		return s
+	}
+	var sb strings.Builder
+	last := 0
+	for _, loc := range reCaseKeep.FindAllStringIndex(s, -1) {
+		sb.WriteString(conv(s[last:loc[0]]))
+		sb.WriteString(s[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	sb.WriteString(conv(s[last:]))
+	return sb.String()
+}
+
+var reLineBreak = regexp.MustCompile(`\n|\\N`)
+
+// dropEmptyLines removes blank lines inside a cue, which would otherwise
+// render as a gap between its lines.
+func dropEmptyLines(s string) string {
+	var kept []string
+	for _, l := range reLineBreak.Split(s, -1) {
+		if strings.TrimSpace(l) != "" {
+			kept = append(kept, l)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
+
+// dropRepeatedLines removes a line that repeats the one right above it
+// (ignoring case and spacing), as auto-captions often do. Returns the text
+// and how many lines went.
+func dropRepeatedLines(s string) (string, int) {
+	lines := reLineBreak.Split(s, -1)
+	kept := lines[:1]
+	for _, l := range lines[1:] {
+		if strings.EqualFold(normalizeSpaces(l), normalizeSpaces(kept[len(kept)-1])) {
+			continue
+		}
+		kept = append(kept, l)
+	}
+	if len(kept) == len(lines) {
+		return s, 0
+	}
+	return strings.Join(kept, "\n"), len(lines) - len(kept)
+}
+
+// defaultSpeakerPatterns are the caption prefixes -strip-speakers removes:
+// ">>" turn markers, [MUSIC] / (laughs) sound tags and all-caps "JOHN:"
+// labels. Mixed-case labels are left to -speaker-pattern, since "Note:" or
+// "Warning:" at the start of a line is as likely to be dialogue.
+var defaultSpeakerPatterns = []string{
+	`^>>\s*`,
+	`^[\[(][^\])]*[\])]\s*`,
+	`^\p{Lu}[\p{Lu}\d.' -]{0,30}:\s+`,
+}
+
+// stripSpeakers removes the patterns from the start of each line, repeating
+// until none matches (">> JOHN: [laughs] hi" becomes "hi"). Lines left empty
+// are dropped.
+func stripSpeakers(s string, patterns []*regexp.Regexp) string {
+	var kept []string
+	for _, l := range reLineBreak.Split(s, -1) {
+		t := strings.TrimSpace(l)
+		for changed := true; changed && t != ""; {
+			changed = false
+			for _, re := range patterns {
+				if loc := re.FindStringIndex(t); loc != nil && loc[1] > 0 {
+					t = strings.TrimSpace(t[loc[1]:])
+					changed = true
+				}
+			}
+		}
+		if t != "" || strings.TrimSpace(l) == "" {
+			kept = append(kept, t)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
+
+var reHTMLStyleTag = regexp.MustCompile(`(?i)<(/?)([bisu])>`)
+
+// htmlStyleToASS turns SRT <i>, <b>, <u> and <s> into {\i1}...{\i0} style
+// overrides. Each line comes out balanced: a span crossing a line break is
+// closed at the end of the line and reopened at the start of the next.
+func htmlStyleToASS(s string) string {
+	if !reHTMLStyleTag.MatchString(s) {
+		return s
+	}
+	open := map[string]bool{}
+	lines := reLineBreak.Split(s, -1)
+	for i, l := range lines {
+		var sb strings.Builder
+		for _, t := range "bisu" {
+			if open[string(t)] {
+				sb.WriteString("{\\" + string(t) + "1}")
+			}
+		}
+		sb.WriteString(reHTMLStyleTag.ReplaceAllStringFunc(l, func(m string) string {
+			p := reHTMLStyleTag.FindStringSubmatch(m)
+			tag := strings.ToLower(p[2])
+			open[tag] = p[1] == ""
+			if open[tag] {
+				return "{\\" + tag + "1}"
+			}
+			return "{\\" + tag + "0}"
+		}))
+		for _, t := range "bisu" {
+			if open[string(t)] {
+				sb.WriteString("{\\" + string(t) + "0}")
+			}
+		}
+		lines[i] = sb.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// escapeLiteralBraces escapes { and } that are part of the dialogue, so
+// "use {brackets}" isn't swallowed as an override block. Blocks starting
+// with a backslash, such as {\an8} or {\i1}, are real tags and kept.
+func escapeLiteralBraces(s string) string {
+	if !strings.ContainsAny(s, "{}") {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			if end := strings.IndexByte(s[i:], '}'); end > 0 && strings.HasPrefix(strings.TrimLeft(s[i+1:], " "), "\\") && !strings.Contains(s[i+1:i+end], "{") {
+				sb.WriteString(s[i : i+end+1])
+				i += end
+				continue
+			}
+			sb.WriteString("\\{")
+		case '}':
+			sb.WriteString("\\}")
+		default:
+			sb.WriteByte(s[i])
+		}
+	}
+	return sb.String()
+}
+
+var reLegacyAlign = regexp.MustCompile(`\\a(\d+)`)
+
+// legacyAlign maps SSA \a values (1-3 bottom, 5-7 top, 9-11 middle) onto
+// numpad-style \an values.
+var legacyAlign = map[string]string{
+	"1": "1", "2": "2", "3": "3",
+	"5": "7", "6": "8", "7": "9",
+	"9": "4", "10": "5", "11": "6",
+}
+
+// normalizeAlignmentTags rewrites legacy \a tags as \an so merging and
+// alignment checks only have to deal with one form. Unknown values are left.
+func normalizeAlignmentTags(s string) string {
+	return reOverrideBlock.ReplaceAllStringFunc(s, func(block string) string {
+		return reLegacyAlign.ReplaceAllStringFunc(block, func(m string) string {
+			if an, ok := legacyAlign[m[2:]]; ok {
+				return "\\an" + an
+			}
+			return m
+		})
+	})
+}
+
+// detectStyle picks "tanda" for all-caps lines (at least one uppercase letter
+// and no lowercase one) and for lines wrapped in () or []. Lines without any
+// cased letter, such as Japanese, numbers or symbols, stay Default.
+func detectStyle(text string) string {
+	t := visibleText(text)
+	if len(t) == 0 {
+		return "Default"
+	}
+	if t == strings.ToUpper(t) && t != strings.ToLower(t) {
+		return "tanda"
+	}
+	if (strings.HasPrefix(t, "(") && strings.HasSuffix(t, ")")) ||
+		(strings.HasPrefix(t, "[") && strings.HasSuffix(t, "]")) {
+		return "tanda"
+	}
+	return "Default"
+}
+
+// ====================== INPUT ======================
+
+// readTextFile reads a subtitle file as UTF-8 text, see decodeText.
+func readTextFile(path string, opts Options) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return decodeText(data, opts)
+}
+
+// decodeText converts input bytes to UTF-8. UTF-16 (LE/BE) with a BOM is
+// always decoded; otherwise opts.Charset forces a codepage, and bytes that
+// aren't valid UTF-8 are read as Windows-1252, the usual encoding of old .srt
+// files. A leftover BOM is stripped.
+func decodeText(data []byte, opts Options) (string, error) {
+	charset := opts.Charset
+	enc := utf16BOM(data)
+	if enc == nil && charset != "" && !isUTF8Label(charset) {
+		var err error
+		if enc, err = htmlindex.Get(charset); err != nil {
+			return "", fmt.Errorf("charset input tidak dikenal: %q", charset)
+		}
+	}
+	if enc == nil && !utf8.Valid(data) {
+		opts.logln("⚠️ Input bukan UTF-8, dibaca sebagai Windows-1252 (gunakan -charset untuk encoding lain)")
+		enc = charmap.Windows1252
+	}
+	if enc == nil {
+		return strings.TrimPrefix(string(data), "\ufeff"), nil
+	}
+	out, err := enc.NewDecoder().Bytes(data)
+	if err != nil {
+		return "", fmt.Errorf("gagal mendekode input: %w", err)
+	}
+	return strings.TrimPrefix(string(out), "\ufeff"), nil
+}
+
+func utf16BOM(data []byte) encoding.Encoding {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		return unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM)
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		return unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM)
+	}
+	return nil
+}
+
+func isUTF8Label(name string) bool {
+	name = strings.ToLower(strings.TrimSpace(name))
+	return name == "" || name == "utf-8" || name == "utf8"
+}
+
+// unmarshalXML is xml.Unmarshal for text already decoded by readTextFile: an
+// encoding="UTF-16" declaration is ignored, other charsets are decoded.
+func unmarshalXML(data []byte, v interface{}) error {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.CharsetReader = func(label string, r io.Reader) (io.Reader, error) {
+		if strings.HasPrefix(strings.ToLower(label), "utf-16") {
+			return r, nil
+		}
+		enc, err := htmlindex.Get(label)
+		if err != nil {
+			return nil, fmt.Errorf("encoding XML tidak dikenal: %q", label)
+		}
+		return enc.NewDecoder().Reader(r), nil
+	}
+	return d.Decode(v)
+}
+
+// ====================== FILE DETECTION ======================
+
+// ParserFunc turns raw file content into subtitle blocks, plus warnings for
+// the parts it had to skip or guess.
+type ParserFunc func(data []byte, opts Options) ([]SRTBlock, []Warning, error)
+
+var parsers = map[string]ParserFunc{}
+
+// RegisterParser makes fn handle files with the given extension (".srt" or
+// "srt"). Registering an extension again replaces its parser.
+func RegisterParser(ext string, fn ParserFunc) {
+	ext = strings.ToLower(ext)
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	parsers[ext] = fn
+}
+
+// textParser wraps a text parser that can't fail as a ParserFunc.
+func textParser(fn func(string) ([]SRTBlock, []Warning)) ParserFunc {
+	return func(data []byte, _ Options) ([]SRTBlock, []Warning, error) {
+		blocks, warns := fn(string(data))
+		return blocks, warns, nil
+	}
+}
+
+func init() {
+	RegisterParser(".srt", func(data []byte, o Options) ([]SRTBlock, []Warning, error) {
+		pos, err := srtPosScale(o)
+		if err != nil {
+			return nil, nil, err
+		}
+		blocks, warns := parseSRTString(string(data), pos)
+		return blocks, warns, nil
+	})
+	RegisterParser(".vtt", textParser(parseVTTToSRT))
+	RegisterParser(".smi", textParser(parseSAMIToSRT))
+	RegisterParser(".sami", textParser(parseSAMIToSRT))
+	RegisterParser(".lrc", textParser(parseLRCToSRT))
+	RegisterParser(".sbv", textParser(parseSBVToSRT))
+	RegisterParser(".json", func(data []byte, o Options) ([]SRTBlock, []Warning, error) {
+		return parseJSONtoSRT(data, o.JSONTimeUnit, o.JSONDefaultDur)
+	})
+	RegisterParser(".xml", func(data []byte, _ Options) ([]SRTBlock, []Warning, error) { return parseXMLtoSRT(data) })
+	RegisterParser(".ttml", func(data []byte, o Options) ([]SRTBlock, []Warning, error) { return parseTTMLtoSRT(data, o.TTMLSpans) })
+}
+
+// supportedFormats lists the registered input formats, e.g. "JSON, SRT, TTML".
+func supportedFormats() string {
+	var names []string
+	for ext := range parsers {
+		names = append(names, strings.ToUpper(strings.TrimPrefix(ext, ".")))
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+func detectFormat(path string) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".ass" {
+		return "ass"
+	}
+	if _, ok := parsers[ext]; ok {
+		return strings.TrimPrefix(ext, ".")
+	}
+	return "unknown"
+}
+
+// ConvertAnyToSRT parses data with the parser registered for path's extension.
+func ConvertAnyToSRT(path string, data []byte, opts Options) ([]SRTBlock, []Warning, error) {
+	return ConvertToSRT(filepath.Ext(path), data, opts)
+}
+
+// ConvertToSRT parses data with the parser registered for format ("vtt" or
+// ".vtt") and returns the blocks with the warnings of this parse.
+func ConvertToSRT(format string, data []byte, opts Options) ([]SRTBlock, []Warning, error) {
+	ext := "." + strings.TrimPrefix(strings.ToLower(format), ".")
+	if ext == ".xml" && isTTML(data) {
+		// TTML saved as .xml, e.g. by some downloaders
+		ext = ".ttml"
+	}
+	fn, ok := parsers[ext]
+	if opts.textFormat != nil {
+		// -text-format replaces whatever the extension would pick
+		fn, ok = parseTextFormat, true
+	}
+	if !ok {
+		return nil, nil, fmt.Errorf("format %q tidak didukung", format)
+	}
+	blocks, warns, err := fn(data, opts)
+	if err != nil {
+		return nil, warns, err
+	}
+	for i := range blocks {
+		// parsers that reorder their cues record the file position themselves
+		if len(blocks[i].Sources) == 0 {
+			blocks[i].Sources = []int{i + 1}
+		}
+	}
+	clampGuessedEnds(blocks)
+	return blocks, warns, nil
+}
+
+// isTTML reports whether the document's root element is <tt>.
+func isTTML(data []byte) bool {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.CharsetReader = func(_ string, r io.Reader) (io.Reader, error) { return r, nil }
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return false
+		}
+		if el, ok := tok.(xml.StartElement); ok {
+			return el.Name.Local == "tt"
+		}
+	}
+}
+
+// ====================== PARSERS ======================
+
+var (
+	reSRTBlockSep = regexp.MustCompile(`\n(?:[ \t]*\n)+`) // blank lines may hold stray spaces
+	reSRTArrow    = regexp.MustCompile(`\s*-->\s*`)
+)
+
+var reSRTCoord = regexp.MustCompile(`\b([XY][12]):\s*(-?\d+)`)
+
+// srtPosScale returns the scale for -srt-pos coordinates (from -source-res,
+// or unscaled, to the 1920x1080 script), or nil when -srt-pos is off.
+func srtPosScale(opts Options) (*resampleScale, error) {
+	if !opts.SRTPos {
+		return nil, nil
+	}
+	srcX, srcY := 1920, 1080
+	if opts.SourceRes != "" {
+		x, y, err := parseResolution(opts.SourceRes)
+		if err != nil {
+			return nil, err
+		}
+		srcX, srcY = x, y
+	}
+	sc := newResampleScale(srcX, srcY, 1920, 1080, opts.ResampleMode)
+	return &sc, nil
+}
+
+// parseSRTString reads blank-line separated SRT blocks. The timing line is the
+// first one containing "-->" (spacing around the arrow is free); anything
+// before it, such as the index, is ignored, so files whose numbering is
+// missing or restarts at 1 read fine. A further timing line inside a block
+// (cues separated by a single newline) starts a new cue, and a number right
+// above it is taken as its index. Blocks are returned in time order.
+// X1:.. X2:.. Y1:.. Y2:.. coordinates after the end time are dropped, or
+// with pos turned into a top-centred {\an8\pos} for the text box.
+func parseSRTString(data string, pos *resampleScale) ([]SRTBlock, []Warning) {
+	data = strings.TrimSpace(strings.ReplaceAll(data, "\r", ""))
+	var out []SRTBlock
+	var w warnList
+	for _, chunk := range reSRTBlockSep.Split(data, -1) {
+		lines := strings.Split(chunk, "\n")
+		var timings []int
+		for i, l := range lines {
+			if strings.Contains(l, "-->") {
+				timings = append(timings, i)
+			}
+		}
+		if len(timings) == 0 {
+			if strings.TrimSpace(chunk) != "" {
+				w.add(len(out)+1, "blok tanpa baris waktu dilewati: %q", lines[0])
+			}
+			continue
+		}
+		for k, timing := range timings {
+			last := len(lines)
+			if k+1 < len(timings) {
+				last = timings[k+1]
+				if _, err := strconv.Atoi(strings.TrimSpace(lines[last-1])); err == nil && last-1 > timing {
+					last--
+				}
+			}
+			parts := reSRTArrow.Split(strings.TrimSpace(lines[timing]), 2)
+			endField, coords := parts[1], ""
+			if f := strings.Fields(parts[1]); len(f) > 1 {
+				endField, coords = f[0], strings.Join(f[1:], " ")
+			}
+			start := w.parseTime(len(out)+1, parts[0])
+			end := w.parseTime(len(out)+1, endField)
+			text := cleanText(strings.Join(lines[timing+1:last], "\n"))
+			if pos != nil && text != "" {
+				text = srtCoordPos(coords, *pos) + text
+			}
+			out = append(out, SRTBlock{Start: start, End: end, Text: text, Sources: []int{len(out) + 1}})
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Start < out[j].Start })
+	return out, w
+}
+
+// srtCoordPos turns "X1:100 X2:200 Y1:300 Y2:400" into {\an8\pos} at the
+// top centre of that box; "" when X1, X2 or Y1 is missing.
+func srtCoordPos(coords string, sc resampleScale) string {
+	c := map[string]int{}
+	for _, m := range reSRTCoord.FindAllStringSubmatch(coords, -1) {
+		c[m[1]], _ = strconv.Atoi(m[2])
+	}
+	for _, k := range []string{"X1", "X2", "Y1"} {
+		if _, ok := c[k]; !ok {
+			return ""
+		}
+	}
+	x := strconv.Itoa((c["X1"] + c["X2"]) / 2)
+	return "{\\an8\\pos(" + sc.x(x) + "," + sc.y(strconv.Itoa(c["Y1"])) + ")}"
+}
+
+// parseTextFormat reads cues with a -text-format regex: every match is one
+// cue, taken from its named groups start, end (optional; a missing end is
+// guessed) and text. Add (?m) or (?s) to the pattern as the layout needs.
+func parseTextFormat(raw []byte, opts Options) ([]SRTBlock, []Warning, error) {
+	re := opts.textFormat
+	data := strings.TrimPrefix(strings.ReplaceAll(string(raw), "\r", ""), "\ufeff")
+	iStart, iEnd, iText := re.SubexpIndex("start"), re.SubexpIndex("end"), re.SubexpIndex("text")
+	var out []SRTBlock
+	var w warnList
+	for _, m := range re.FindAllStringSubmatch(data, -1) {
+		b := SRTBlock{Start: w.parseTime(len(out)+1, m[iStart]), Text: cleanText(m[iText])}
+		if iEnd >= 0 && m[iEnd] != "" {
+			b.End = w.parseTime(len(out)+1, m[iEnd])
+		} else {
+			b.End, b.EndGuessed = b.Start+2*time.Second, true
+		}
+		out = append(out, b)
+	}
+	return out, w, nil
+}
+
+var reVTTMarkup = regexp.MustCompile(`</?(?:c|v|lang|ruby|rt)(?:[.\s][^>]*)?>|<\d[\d:.]*>`)
+
+// parseVTTToSRT reads WebVTT. Header, NOTE, STYLE and REGION blocks are
+// skipped; a line before the timing line is the cue identifier, not text.
+// Cue settings after the end time and voice/class markup are dropped.
+func parseVTTToSRT(data string) ([]SRTBlock, []Warning) {
+	data = strings.TrimSpace(strings.TrimPrefix(strings.ReplaceAll(data, "\r", ""), "\ufeff"))
+	var out []SRTBlock
+	var w warnList
+	for _, chunk := range reSRTBlockSep.Split(data, -1) {
+		lines := strings.Split(chunk, "\n")
+		first := strings.TrimSpace(lines[0])
+		if strings.HasPrefix(first, "WEBVTT") || strings.HasPrefix(first, "NOTE") ||
+			strings.HasPrefix(first, "STYLE") || strings.HasPrefix(first, "REGION") {
+			continue
+		}
+		timing := -1
+		for i, l := range lines {
+			if strings.Contains(l, "-->") {
+				timing = i
+				break
+			}
+		}
+		if timing < 0 || timing > 1 {
+			w.add(len(out)+1, "blok tanpa baris waktu dilewati: %q", first)
+			continue
+		}
+		parts := reSRTArrow.Split(strings.TrimSpace(lines[timing]), 2)
+		endField := strings.Fields(parts[1])
+		if len(endField) == 0 {
+			w.add(len(out)+1, "waktu selesai tidak ada: %q", lines[timing])
+			continue
+		}
+		start := w.parseTime(len(out)+1, parts[0])
+		end := w.parseTime(len(out)+1, endField[0])
+		text := html.UnescapeString(reVTTMarkup.ReplaceAllString(strings.Join(lines[timing+1:], "\n"), ""))
+		out = append(out, SRTBlock{Start: start, End: end, Text: cleanText(text)})
+	}
+	return out, w
+}
+
+var (
+	reSAMISync  = regexp.MustCompile(`(?i)<sync\b[^>]*>`)
+	reSAMIStart = regexp.MustCompile(`(?i)\bstart\s*=\s*["']?(\d+)`)
+)
+
+// parseSAMIToSRT reads SAMI (.smi/.sami). Each <SYNC Start=ms> opens a cue
+// that ends at the next SYNC (last one: +2s); a SYNC holding only &nbsp; just
+// clears the previous cue.
+func parseSAMIToSRT(data string) ([]SRTBlock, []Warning) {
+	locs := reSAMISync.FindAllStringIndex(data, -1)
+	var out []SRTBlock
+	var w warnList
+	pending := false
+	for i, loc := range locs {
+		m := reSAMIStart.FindStringSubmatch(data[loc[0]:loc[1]])
+		if m == nil {
+			w.add(len(out)+1, "SYNC tanpa Start dilewati")
+			continue
+		}
+		ms, _ := strconv.ParseInt(m[1], 10, 64)
+		start := time.Duration(ms) * time.Millisecond
+		if pending {
+			out[len(out)-1].End = start
+			pending = false
+		}
+		bodyEnd := len(data)
+		if i+1 < len(locs) {
+			bodyEnd = locs[i+1][0]
+		}
+		text := cleanText(stripTagsButPreserveNewlines(normalizeBrTags(data[loc[1]:bodyEnd])))
+		if text == "" {
+			continue
+		}
+		out = append(out, SRTBlock{Start: start, End: start + 2000*time.Millisecond, Text: text})
+		pending = true
+	}
+	return out, w
+}
+
+var (
+	reLRCTime = regexp.MustCompile(`^\[(\d+):(\d+(?:[.:]\d+)?)\]`)
+	reLRCTag  = regexp.MustCompile(`^\[[a-zA-Z#]+:.*\]$`)
+)
+
+// parseLRCToSRT reads .lrc lyrics. A line may carry several [mm:ss.xx]
+// stamps (repeated chorus), giving one cue each; every cue ends where the
+// next stamp starts (last one: +2s). ID tags like [ar:] and [ti:] are ignored.
+func parseLRCToSRT(data string) ([]SRTBlock, []Warning) {
+	var out []SRTBlock
+	var w warnList
+	for _, line := range strings.Split(strings.ReplaceAll(data, "\r", ""), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || reLRCTag.MatchString(line) && !reLRCTime.MatchString(line) {
+			continue
+		}
+		var starts []time.Duration
+		for {
+			m := reLRCTime.FindStringSubmatch(line)
+			if m == nil {
+				break
+			}
+			min, _ := strconv.Atoi(m[1])
+			sec, _ := strconv.ParseFloat(strings.Replace(m[2], ":", ".", 1), 64)
+			starts = append(starts, time.Duration(min)*time.Minute+time.Duration(sec*float64(time.Second)))
+			line = strings.TrimSpace(line[len(m[0]):])
+		}
+		if len(starts) == 0 {
+			w.add(len(out)+1, "baris LRC tanpa timestamp dilewati: %q", line)
+			continue
+		}
+		for _, st := range starts {
+			out = append(out, SRTBlock{Start: st, Text: line, Sources: []int{len(out) + 1}})
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Start < out[j].Start })
+	for i := range out {
+		if i+1 < len(out) {
+			out[i].End = out[i+1].Start
+		} else {
+			out[i].End = out[i].Start + 2000*time.Millisecond
+		}
+	}
+	// empty lyric lines only mark where the previous line stops
+	kept := out[:0]
+	for _, b := range out {
+		if b.Text != "" {
+			kept = append(kept, b)
+		}
+	}
+	return kept, w
+}
+
+// parseSBVToSRT reads YouTube .sbv captions: a "0:00:01.000,0:00:05.000"
+// timing line followed by the text, blocks separated by blank lines.
+func parseSBVToSRT(data string) ([]SRTBlock, []Warning) {
+	data = strings.TrimSpace(strings.ReplaceAll(data, "\r", ""))
+	var out []SRTBlock
+	var w warnList
+	for _, chunk := range reSRTBlockSep.Split(data, -1) {
+		lines := strings.Split(chunk, "\n")
+		times := strings.SplitN(strings.TrimSpace(lines[0]), ",", 2)
+		if len(times) != 2 {
+			if strings.TrimSpace(chunk) != "" {
+				w.add(len(out)+1, "blok tanpa baris waktu dilewati: %q", lines[0])
+			}
+			continue
+		}
+		start := w.parseTime(len(out)+1, times[0])
+		end := w.parseTime(len(out)+1, times[1])
+		out = append(out, SRTBlock{Start: start, End: end, Text: cleanText(strings.Join(lines[1:], "\n"))})
+	}
+	return out, w
+}
+
+func parseTime(s string) (time.Duration, error) {
+	ms, err := parseTimeStringToMs(s)
+	return time.Duration(ms) * time.Millisecond, err
+}
+
+// parseTimeStringToMs parses clock timestamps (h:mm:ss,mmm, mm:ss.xx; fields
+// need no zero padding, so 0:0:01,5 is 1.5s), unit suffixed values ("2.5s",
+// "2500ms") and bare numbers (> 1000 read as ms, otherwise seconds).
+// Full-width digits from CJK sources are accepted.
+func parseTimeStringToMs(s string) (int64, error) {
+	s = strings.TrimSpace(normalizeDigits(s))
+	if s == "" {
+		return 0, fmt.Errorf("invalid time")
+	}
+	if !strings.Contains(s, ":") {
+		switch {
+		case strings.HasSuffix(s, "ms"):
+			v, err := strconv.ParseFloat(strings.TrimSuffix(s, "ms"), 64)
+			return int64(math.Round(v)), err
+		case strings.HasSuffix(s, "s"):
+			v, err := strconv.ParseFloat(strings.TrimSuffix(s, "s"), 64)
+			return int64(math.Round(v * 1000)), err
+		}
+		v, err := strconv.ParseFloat(strings.ReplaceAll(s, ",", "."), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid time")
+		}
+		if v > 1000 {
+			return int64(math.Round(v)), nil
+		}
+		return int64(math.Round(v * 1000)), nil
+	}
+	parts := strings.Split(strings.ReplaceAll(s, ",", "."), ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("invalid time")
+	}
+	sec, err := strconv.ParseFloat(parts[len(parts)-1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time")
+	}
+	min, err := strconv.Atoi(parts[len(parts)-2])
+	if err != nil {
+		return 0, fmt.Errorf("invalid time")
+	}
+	hour := 0
+	if len(parts) == 3 {
+		if hour, err = strconv.Atoi(parts[0]); err != nil {
+			return 0, fmt.Errorf("invalid time")
+		}
+	}
+	return int64(hour)*3600000 + int64(min)*60000 + int64(math.Round(sec*1000)), nil
+}
+
+// normalizeDigits maps full-width digits and separators (０-９, ：, ，, ．)
+// to their ASCII forms.
+func normalizeDigits(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= '０' && r <= '９':
+			return '0' + (r - '０')
+		case r == '：':
+			return ':'
+		case r == '，':
+			return ','
+		case r == '．':
+			return '.'
+		}
+		return r
+	}, s)
+}
+
+func parseJSONtoSRT(data []byte, unit string, fallback time.Duration) ([]SRTBlock, []Warning, error) {
+	// YouTube json3: {"events":[{"tStartMs":..,"dDurationMs":..,"segs":[{"utf8":..}]}]}
+	var doc struct {
+		Events []map[string]interface{} `json:"events"`
+	}
+	err := json.Unmarshal(data, &doc)
+	if err == nil && len(doc.Events) > 0 {
+		blocks, warns := jsonEventsToSRT(doc.Events, unit, fallback)
+		return blocks, warns, nil
+	}
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return nil, nil, fmt.Errorf("JSON tidak valid (byte %d): %v", syntaxErr.Offset, err)
+	}
+	var entries []map[string]interface{}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, nil, fmt.Errorf("struktur JSON tidak dikenali: butuh {\"events\": [...]} atau array cue")
+	}
+	blocks, warns := jsonEventsToSRT(entries, unit, fallback)
+	return blocks, warns, nil
+}
+
+// jsonEventsToSRT converts generic JSON caption events. tStartMs/dDurationMs
+// are always milliseconds; plain numeric start/end/dur follow unit (ms, s or
+// auto), while string values are parsed as timestamps. A text event without a
+// usable duration (missing, 0 or negative) lasts until the next cue, but at
+// most fallback (0 = 2s).
+func jsonEventsToSRT(events []map[string]interface{}, unit string, fallback time.Duration) ([]SRTBlock, []Warning) {
+	if unit == "" || unit == "auto" {
+		unit = detectJSONTimeUnit(events)
+	}
+	if fallback <= 0 {
+		fallback = 2 * time.Second
+	}
+	var out []SRTBlock
+	var w warnList
+	lastInWin := map[string]int{} // wWinId -> its latest cue in out
+	for i, e := range events {
+		text := jsonEventText(e)
+		win, hasWin := winKey(e["wWinId"])
+		if !hasWin && e["wWinId"] != nil {
+			w.add(i+1, "wWinId tidak dikenali, event dianggap tanpa jendela: %v", e["wWinId"])
+		}
+		target, appendTo := len(out)-1, len(out) > 0 && jsonFlag(e["aAppend"])
+		if j, ok := lastInWin[win]; ok && hasWin && appendTo {
+			target = j
+		}
+		if text == "" && !appendTo {
+			// "segs": [] or window-only events carry nothing to show
+			continue
+		}
+		start, ok := jsonTime(e["tStartMs"], "ms")
+		if !ok {
+			if start, ok = jsonTime(e["start"], unit); !ok {
+				w.add(i+1, "waktu mulai tidak valid: %v", e["start"])
+			}
+		}
+		end, ok := jsonTime(e["end"], unit)
+		guessed := false
+		if ok && end < start {
+			w.add(i+1, "waktu selesai sebelum waktu mulai diabaikan: %v", e["end"])
+			ok = false
+		}
+		if !ok {
+			if dur, ok := jsonTime(e["dDurationMs"], "ms"); ok && dur > 0 {
+				end = start + dur
+			} else if dur, ok := jsonTime(e["dur"], unit); ok && dur > 0 {
+				end = start + dur
+			} else {
+				for _, k := range []string{"dDurationMs", "dur"} {
+					if v, ok := e[k].(float64); ok && v < 0 {
+						w.add(i+1, "durasi negatif diabaikan: %v", v)
+					}
+				}
+				// clampGuessedEnds pulls this back to the next cue's start
+				end, guessed = start+fallback, true
+			}
+		}
+		if appendTo {
+			// rolling caption: the event adds a line to what its window
+			// (wWinId) already shows instead of replacing it
+			last := &out[target]
+			if text != "" {
+				last.Text += "\n" + text
+			}
+			if end > last.End {
+				last.End = end
+			}
+			continue
+		}
+		if hasWin {
+			lastInWin[win] = len(out)
+		}
+		out = append(out, SRTBlock{Start: start, End: end, Text: text, EndGuessed: guessed})
+	}
+	return out, w
+}
+
+// winKey turns a wWinId into a map key. Only numbers and strings name a
+// window; anything else (arrays, objects, booleans) reports false.
+func winKey(v interface{}) (string, bool) {
+	switch t := v.(type) {
+	case float64:
+		return strconv.FormatFloat(t, 'g', -1, 64), true
+	case string:
+		return strconv.Quote(t), true
+	}
+	return "", false
+}
+
+// jsonFlag reads a 0/1 or boolean JSON field such as aAppend.
+func jsonFlag(v interface{}) bool {
+	switch t := v.(type) {
+	case float64:
+		return t != 0
+	case bool:
+		return t
+	}
+	return false
+}
+
+// detectJSONTimeUnit guesses seconds when plain numeric start values carry a
+// fractional part (e.g. "start": 12.5); otherwise they are milliseconds.
+func detectJSONTimeUnit(events []map[string]interface{}) string {
+	fractional := false
+	for _, e := range events {
+		v, ok := e["start"].(float64)
+		if !ok {
+			continue
+		}
+		if v >= 86400 {
+			return "ms"
+		}
+		if v != float64(int64(v)) {
+			fractional = true
+		}
+	}
+	if fractional {
+		return "s"
+	}
+	return "ms"
+}
+
+func jsonTime(v interface{}, unit string) (time.Duration, bool) {
+	switch t := v.(type) {
+	case float64:
+		if unit == "s" {
+			return time.Duration(t * float64(time.Second)), true
+		}
+		return time.Duration(t * float64(time.Millisecond)), true
+	case string:
+		if n, err := strconv.ParseFloat(t, 64); err == nil {
+			return jsonTime(n, unit)
+		}
+		d, err := parseTime(t)
+		return d, err == nil
+	}
+	return 0, false
+}
+
+func jsonEventText(e map[string]interface{}) string {
+	if segs, ok := e["segs"].([]interface{}); ok {
+		var sb strings.Builder
+		for _, seg := range segs {
+			if m, ok := seg.(map[string]interface{}); ok {
+				if s, ok := m["utf8"].(string); ok {
+					sb.WriteString(s)
+				}
+			}
+		}
+		return cleanText(sb.String())
+	}
+	if s, ok := e["text"].(string); ok {
+		return cleanText(s)
+	}
+	return ""
+}
+
+func parseXMLtoSRT(data []byte) ([]SRTBlock, []Warning, error) {
+	type Node struct {
+		Start string `xml:"start,attr"`
+		End   string `xml:"end,attr"`
+		Text  string `xml:",chardata"`
+	}
+	var n struct {
+		Body []Node `xml:"body>p"`
+	}
+	if err := unmarshalXML(data, &n); err != nil {
+		return nil, nil, fmt.Errorf("XML tidak valid: %w", err)
+	}
+	var out []SRTBlock
+	var w warnList
+	for i, p := range n.Body {
+		start := w.parseTime(i+1, p.Start)
+		end := w.parseTime(i+1, p.End)
+		txt := strings.ReplaceAll(p.Text, "\n", " ")
+		out = append(out, SRTBlock{Start: start, End: end, Text: txt})
+	}
+	return out, w, nil
+}
+
+type ttmlPara struct {
+	Begin string `xml:"begin,attr"`
+	End   string `xml:"end,attr"`
+	Dur   string `xml:"dur,attr"`
+	Text  string `xml:",innerxml"`
+}
+
+// ttmlBody collects the <p> cues of <body> at any <div> depth, skipping
+// <metadata> and <ttm:agent> blocks whose <p>s are not subtitles.
+type ttmlBody struct {
+	Paras []ttmlPara
+}
+
+func (b *ttmlBody) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	depth := 0
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "p":
+				var p ttmlPara
+				if err := d.DecodeElement(&p, &t); err != nil {
+					return err
+				}
+				b.Paras = append(b.Paras, p)
+			case "metadata", "agent":
+				if err := d.Skip(); err != nil {
+					return err
+				}
+			default:
+				depth++
+			}
+		case xml.EndElement:
+			if depth == 0 {
+				return nil
+			}
+			depth--
+		}
+	}
+}
+
+func parseTTMLtoSRT(data []byte, spans bool) ([]SRTBlock, []Warning, error) {
+	var n struct {
+		Body ttmlBody `xml:"body"`
+	}
+	if err := unmarshalXML(data, &n); err != nil {
+		return nil, nil, fmt.Errorf("TTML tidak valid: %w", err)
+	}
+	var out []SRTBlock
+	var w warnList
+	for i, p := range n.Body.Paras {
+		start := w.parseTime(i+1, p.Begin)
+		var end time.Duration
+		guessed := false
+		switch {
+		case p.End != "":
+			end = w.parseTime(i+1, p.End)
+		case p.Dur != "":
+			end = start + ttmlDuration(&w, i+1, p.Dur)
+		default:
+			end, guessed = start+2000*time.Millisecond, true
+		}
+		if spans {
+			if spans := timedSpans(p.Text, start, end); len(spans) > 0 {
+				out = append(out, spans...)
+				continue
+			}
+		}
+		txt := stripTagsButPreserveNewlines(normalizeBrTags(p.Text))
+		out = append(out, SRTBlock{Start: start, End: end, Text: cleanText(txt), EndGuessed: guessed})
+	}
+	return out, w, nil
+}
+
+// ttmlDuration reads a dur attribute. A bare number is seconds, as in TTML,
+// instead of the "> 1000 means ms" guess parseTimeStringToMs makes.
+func ttmlDuration(w *warnList, index int, s string) time.Duration {
+	if v, err := strconv.ParseFloat(strings.TrimSpace(normalizeDigits(s)), 64); err == nil {
+		return time.Duration(math.Round(v*1000)) * time.Millisecond
+	}
+	return w.parseTime(index, s)
+}
+
+// timedSpans splits a <p> whose <span>s carry their own begin/end (word-level
+// TTML) into one cue per span. Span times are relative to the enclosing
+// paragraph's or timed span's begin, as TTML's time containment says; a
+// missing end runs to the enclosing end. A timed span nested in another
+// becomes its own cue and is left out of the outer one's text, and text
+// outside the timed spans becomes one more cue with the <p>'s timing.
+func timedSpans(inner string, pStart, pEnd time.Duration) []SRTBlock {
+	type span struct {
+		start, end time.Duration
+		text       strings.Builder // markup-free apart from <br/>
+	}
+	root := &span{start: pStart, end: pEnd}
+	all := []*span{root}
+	open := []*span{root} // the timed span each open element belongs to
+	d := xml.NewDecoder(strings.NewReader("<p>" + inner + "</p>"))
+	d.Strict = false
+	d.Entity = xml.HTMLEntity
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil
+		}
+		cur := open[len(open)-1]
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Local == "br" {
+				cur.text.WriteString("<br/>")
+			} else {
+				// tags separate words, as in stripTagsButPreserveNewlines
+				cur.text.WriteString(" ")
+			}
+			if start, end, ok := timedSpan(t, cur.start, cur.end); ok {
+				cur = &span{start: start, end: end}
+				all = append(all, cur)
+			}
+			open = append(open, cur)
+		case xml.EndElement:
+			if len(open) > 1 {
+				open = open[:len(open)-1]
+			}
+			open[len(open)-1].text.WriteString(" ")
+		case xml.CharData:
+			xml.EscapeText(&cur.text, t)
+		}
+	}
+	if len(all) == 1 {
+		return nil
+	}
+	var out []SRTBlock
+	for _, s := range all {
+		if txt := cleanText(stripTagsButPreserveNewlines(normalizeBrTags(s.text.String()))); txt != "" {
+			out = append(out, SRTBlock{Start: s.start, End: s.end, Text: txt})
+		}
+	}
+	return out
+}
+
+// timedSpan reports whether t is a <span> with a begin time and, if so,
+// where it starts and ends inside a container running from start to end.
+func timedSpan(t xml.StartElement, start, end time.Duration) (time.Duration, time.Duration, bool) {
+	if t.Name.Local != "span" {
+		return 0, 0, false
+	}
+	attrs := map[string]string{}
+	for _, a := range t.Attr {
+		attrs[a.Name.Local] = a.Value
+	}
+	begin, err := parseTime(attrs["begin"])
+	if err != nil {
+		return 0, 0, false
+	}
+	if e, err := parseTime(attrs["end"]); err == nil {
+		end = start + e
+	}
+	return start + begin, end, true
+}
+
+var (
+	reXMLWhitespace = regexp.MustCompile(`\s+`)
+	reBrTag         = regexp.MustCompile(`(?i)<(?:[a-z0-9]+:)?br\s*/?>(?:\s*</(?:[a-z0-9]+:)?br>)?`)
+	reXMLTag        = regexp.MustCompile(`<[^>]*>`)
+)
+
+// normalizeBrTags turns <br/> (including namespaced tt:br and ones nested in
+// <span>) into "\n". Source indentation whitespace is collapsed first so only
+// real line breaks survive.
+func normalizeBrTags(s string) string {
+	s = reXMLWhitespace.ReplaceAllString(s, " ")
+	return reBrTag.ReplaceAllString(s, "\n")
+}
+
+// stripTagsButPreserveNewlines drops the remaining markup (span etc.) without
+// gluing words together, then tidies every line.
+func stripTagsButPreserveNewlines(s string) string {
+	s = html.UnescapeString(reXMLTag.ReplaceAllString(s, ""))
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimSpace(reMultiSpace.ReplaceAllString(l, " "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ====================== TIMING ======================
+
+// clampGuessedEnds cuts a default (EndGuessed) end back to the start of the
+// next cue when that comes sooner, so a missing end doesn't overlap it.
+func clampGuessedEnds(blocks []SRTBlock) {
+	order := make([]int, len(blocks))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return blocks[order[a]].Start < blocks[order[b]].Start })
+	for k, i := range order {
+		if !blocks[i].EndGuessed {
+			continue
+		}
+		for _, j := range order[k+1:] {
+			if blocks[j].Start > blocks[i].Start {
+				if blocks[j].Start < blocks[i].End {
+					blocks[i].End = blocks[j].Start
+				}
+				break
+			}
+		}
+	}
+}
+
+// capDurations shortens cues longer than max to max, keeping their start.
+// Meant for runaway durations coming from missing/broken end times.
+func capDurations(blocks []SRTBlock, max time.Duration) int {
+	n := 0
+	for i := range blocks {
+		if blocks[i].End-blocks[i].Start > max {
+			blocks[i].End = blocks[i].Start + max
+			n++
+		}
+	}
+	return n
+}
+
+// enforceDurations lengthens cues shorter than min (up to the start of the
+// next cue of the same style at most) and caps cues longer than max; 0 turns
+// either limit off. Returns how many cues were lengthened and shortened.
+func enforceDurations(blocks []SRTBlock, min, max time.Duration) (extended, capped int) {
+	if min > 0 {
+		sort.SliceStable(blocks, func(i, j int) bool { return blocks[i].Start < blocks[j].Start })
+		for i := range blocks {
+			b := &blocks[i]
+			if b.End-b.Start >= min {
+				continue
+			}
+			end := b.Start + min
+			for j := i + 1; j < len(blocks); j++ {
+				if blocks[j].Style == b.Style && blocks[j].Start > b.Start {
+					if blocks[j].Start < end {
+						end = blocks[j].Start
+					}
+					break
+				}
+			}
+			if end > b.End {
+				b.End = end
+				extended++
+			}
+		}
+	}
+	if max > 0 {
+		capped = capDurations(blocks, max)
+	}
+	return extended, capped
+}
+
+// cueCPS returns the reading speed of b in characters per second, counting
+// the visible text only.
+func cueCPS(b SRTBlock) float64 {
+	dur := (b.End - b.Start).Seconds()
+	if dur <= 0 {
+		return math.Inf(1)
+	}
+	text := strings.ReplaceAll(plainText(b.Text), "\n", "")
+	return float64(utf8.RuneCountInString(text)) / dur
+}
+
+// fixCPS extends the end of cues read faster than maxCPS until they reach
+// it, but never past the start of the next cue of the same style. Returns
+// how many cues were lengthened.
+func fixCPS(blocks []SRTBlock, maxCPS float64) int {
+	sort.SliceStable(blocks, func(i, j int) bool { return blocks[i].Start < blocks[j].Start })
+	n := 0
+	for i := range blocks {
+		b := &blocks[i]
+		if cueCPS(*b) <= maxCPS {
+			continue
+		}
+		chars := utf8.RuneCountInString(strings.ReplaceAll(plainText(b.Text), "\n", ""))
+		end := b.Start + time.Duration(math.Ceil(float64(chars)/maxCPS*1000))*time.Millisecond
+		for j := i + 1; j < len(blocks); j++ {
+			if blocks[j].Style == b.Style && blocks[j].Start > b.Start {
+				if blocks[j].Start < end {
+					end = blocks[j].Start
+				}
+				break
+			}
+		}
+		if end > b.End {
+			b.End = end
+			n++
+		}
+	}
+	return n
+}
+
+// fixOverlaps pulls the end of a cue back to gap before the start of the
+// next cue of the same style when the two overlap, so players don't flicker
+// between them. Cues that would end up empty are left alone. Returns how many
+// cues were shortened.
+func fixOverlaps(blocks []SRTBlock, gap time.Duration) int {
+	sort.SliceStable(blocks, func(i, j int) bool { return blocks[i].Start < blocks[j].Start })
+	n := 0
+	for i := range blocks {
+		b := &blocks[i]
+		for j := i + 1; j < len(blocks); j++ {
+			if blocks[j].Style == b.Style && blocks[j].Start > b.Start {
+				if end := blocks[j].Start - gap; end < b.End && end > b.Start {
+					b.End = end
+					n++
+				}
+				break
+			}
+		}
+	}
+	return n
+}
+
+// rescaleTimings multiplies every timing by factor, for subtitles timed
+// against a rip with a different frame rate (PAL speed-up and the like).
+func rescaleTimings(blocks []SRTBlock, factor float64) {
+	for i := range blocks {
+		blocks[i].Start = time.Duration(math.Round(float64(blocks[i].Start) * factor))
+		blocks[i].End = time.Duration(math.Round(float64(blocks[i].End) * factor))
+	}
+}
+
+// shiftBlocks moves every cue by offset, clamping times that would fall
+// before zero.
+func shiftBlocks(blocks []SRTBlock, offset time.Duration) {
+	for i := range blocks {
+		blocks[i].Start += offset
+		blocks[i].End += offset
+		if blocks[i].Start < 0 {
+			blocks[i].Start = 0
+		}
+		if blocks[i].End < 0 {
+			blocks[i].End = 0
+		}
+	}
+}
+
+// splitAtTimes cuts blocks into len(cuts)+1 parts. A cue belongs to the part
+// its start falls in, even when it runs past the boundary. With rebase each
+// part's timings are shifted so the part starts at zero.
+func splitAtTimes(blocks []SRTBlock, cuts []time.Duration, rebase bool) [][]SRTBlock {
+	cuts = append([]time.Duration(nil), cuts...)
+	sort.Slice(cuts, func(i, j int) bool { return cuts[i] < cuts[j] })
+	parts := make([][]SRTBlock, len(cuts)+1)
+	for _, b := range blocks {
+		k := sort.Search(len(cuts), func(i int) bool { return cuts[i] > b.Start })
+		if rebase && k > 0 {
+			b.Start -= cuts[k-1]
+			b.End -= cuts[k-1]
+		}
+		parts[k] = append(parts[k], b)
+	}
+	return parts
+}
+
+// maxDenseCueLen bounds how much text joinDenseCues piles into one cue
+// (two 42-character lines).
+const maxDenseCueLen = 84
+
+// joinDenseCues folds cues starting less than interval after the previous
+// one into it, joining the text with a space, until the cue would exceed
+// maxDenseCueLen. Meant for ASR captions that emit a new event every few
+// hundred milliseconds; unlike the merge steps the texts differ.
+func joinDenseCues(blocks []SRTBlock, interval time.Duration) []SRTBlock {
+	sort.SliceStable(blocks, func(i, j int) bool { return blocks[i].Start < blocks[j].Start })
+	var out []SRTBlock
+	for _, b := range blocks {
+		if len(out) > 0 {
+			last := &out[len(out)-1]
+			text := strings.TrimSpace(b.Text)
+			if last.Style == b.Style && b.Start-last.Start < interval &&
+				utf8.RuneCountInString(last.Text)+1+utf8.RuneCountInString(text) <= maxDenseCueLen {
+				if text != "" {
+					last.Text = strings.TrimSpace(last.Text) + " " + text
+				}
+				if b.End > last.End {
+					last.End = b.End
+				}
+				last.Sources = append(last.Sources, b.Sources...)
+				continue
+			}
+		}
+		out = append(out, b)
+	}
+	return out
+}
+
+// ====================== AUDIT ======================
+
+// sourceIndex is the 1-based position of blocks[i] in the input file, for
+// warnings about blocks that may have been reordered.
+func sourceIndex(blocks []SRTBlock, i int) int {
+	if len(blocks[i].Sources) > 0 {
+		return blocks[i].Sources[0]
+	}
+	return i + 1
+}
+
+// auditTimeJumps flags cues whose start jumps far past the previous cue
+// compared to the file's typical spacing, e.g. a corrupt timestamp putting one
+// line at hour 50 of a 20 minute episode.
+func auditTimeJumps(blocks []SRTBlock) []Warning {
+	if len(blocks) < 3 {
+		return nil
+	}
+	order := make([]int, len(blocks))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return blocks[order[a]].Start < blocks[order[b]].Start })
+
+	gaps := make([]time.Duration, 0, len(order)-1)
+	for k := 1; k < len(order); k++ {
+		gaps = append(gaps, blocks[order[k]].Start-blocks[order[k-1]].Start)
+	}
+	sorted := append([]time.Duration(nil), gaps...)
+	sort.Slice(sorted, func(a, b int) bool { return sorted[a] < sorted[b] })
+	median := sorted[len(sorted)/2]
+
+	var out []Warning
+	for k, gap := range gaps {
+		if gap > 5*time.Minute && gap > 50*median {
+			b := blocks[order[k+1]]
+			out = append(out, Warning{Index: sourceIndex(blocks, order[k+1]), Msg: fmt.Sprintf("lompatan waktu mencurigakan ke %s (%s setelah cue sebelumnya)", formatTimeSRT(b.Start), gap.Round(time.Second))})
+		}
+	}
+	return out
+}
+
+// dropDuplicateCues removes cues whose start, end and text repeat an earlier
+// cue exactly, as in a file whose content got appended twice. Returns the
+// remaining cues and how many were dropped.
+func dropDuplicateCues(blocks []SRTBlock) ([]SRTBlock, int) {
+	type key struct {
+		start, end time.Duration
+		text       string
+	}
+	seen := make(map[key]bool, len(blocks))
+	var out []SRTBlock
+	for _, b := range blocks {
+		k := key{b.Start, b.End, b.Text}
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		out = append(out, b)
+	}
+	return out, len(blocks) - len(out)
+}
+
+// validateBlocks reports cues with no or negative duration and cues that
+// overlap the one before them (in start order) of the same style and layer;
+// a sign shown over dialogue is normal. Exact repeats are left to
+// dropDuplicateCues. The blocks are not changed.
+func validateBlocks(blocks []SRTBlock) []Warning {
+	order := make([]int, len(blocks))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return blocks[order[a]].Start < blocks[order[b]].Start })
+
+	type track struct {
+		style string
+		layer int
+	}
+	last := map[track]int{}
+	var out []Warning
+	for _, i := range order {
+		b := blocks[i]
+		switch {
+		case b.End == b.Start:
+			out = append(out, Warning{Index: sourceIndex(blocks, i), Msg: fmt.Sprintf("durasi nol di %s", formatTimeSRT(b.Start))})
+		case b.End < b.Start:
+			out = append(out, Warning{Index: sourceIndex(blocks, i), Msg: fmt.Sprintf("waktu selesai %s sebelum waktu mulai %s", formatTimeSRT(b.End), formatTimeSRT(b.Start))})
+		}
+		key := track{b.Style, b.Layer}
+		if j, ok := last[key]; ok {
+			prev := blocks[j]
+			dup := b.Start == prev.Start && b.End == prev.End && b.Text == prev.Text
+			if !dup && b.Start < prev.End && prev.End > prev.Start {
+				out = append(out, Warning{Index: sourceIndex(blocks, i), Msg: fmt.Sprintf("tumpang tindih %s dengan blok %d", prev.End-b.Start, sourceIndex(blocks, j))})
+			}
+		}
+		last[key] = i
+	}
+	return out
+}
+
+// ====================== MERGE LOGIC ======================
+
+// byStartThenSource orders cues by start time, and cues starting together by
+// their position in the source file, so same-time lines always join in the
+// order they were written.
+func byStartThenSource(a, b SRTBlock) bool {
+	if a.Start != b.Start {
+		return a.Start < b.Start
+	}
+	if len(a.Sources) > 0 && len(b.Sources) > 0 {
+		return a.Sources[0] < b.Sources[0]
+	}
+	return false
+}
+
+// mergeSameOrContinuous joins repeats of the same text that follow each other
+// within tolerance (0 turns this off; repeats with the same start are still
+// folded). With maxDur > 0 a run is closed once it would grow past maxDur, so
+// a recurring sign doesn't become one five-minute line. With keepTandaGaps
+// tanda repeats only join when they touch or overlap, so the same sign shown
+// again after a scene cut stays a separate line.
+func mergeSameOrContinuous(blocks []SRTBlock, tolerance, maxDur time.Duration, keepTandaGaps bool) []SRTBlock {
+	sort.SliceStable(blocks, func(i, j int) bool { return byStartThenSource(blocks[i], blocks[j]) })
+	var out []SRTBlock
+	for _, b := range blocks {
+		if len(out) == 0 {
+			out = append(out, b)
+			continue
+		}
+		last := &out[len(out)-1]
+		if last.Style == b.Style && normalizeSpaces(last.Text) == normalizeSpaces(b.Text) {
+			gap := b.Start - last.End
+			if b.Start == last.Start {
+				// same start, same text: an overlapping repeat, keep the longer one
+				if b.End > last.End {
+					last.End = b.End
+				}
+				last.Sources = append(last.Sources, b.Sources...)
+				continue
+			}
+			tol := tolerance
+			if keepTandaGaps && b.Style == "tanda" {
+				tol = 0
+			}
+			if tolerance > 0 && gap <= tol && (maxDur <= 0 || b.End-last.Start <= maxDur) {
+				if b.End > last.End {
+					last.End = b.End
+				}
+				last.Sources = append(last.Sources, b.Sources...)
+				continue
+			}
+		}
+		out = append(out, b)
+	}
+	return out
+}
+
+// mergeSameTimeAndStyle handles cues of one style with identical timing per
+// -same-time-behavior: "join" stacks their text as lines of one event,
+// "layer" keeps them apart but moves each later one up a layer, and "keep"
+// leaves them as they are.
+func mergeSameTimeAndStyle(blocks []SRTBlock, mode string) []SRTBlock {
+	if mode == "keep" {
+		return blocks
+	}
+	var out []SRTBlock
+	for _, b := range blocks {
+		merged := false
+		for i := range out {
+			if out[i].Start == b.Start && out[i].End == b.End && out[i].Style == b.Style && out[i].Text != b.Text {
+				if mode == "layer" {
+					if out[i].Layer >= b.Layer {
+						b.Layer = out[i].Layer + 1
+					}
+					continue
+				}
+				out[i].Text = out[i].Text + "\n" + b.Text
+				out[i].Sources = append(out[i].Sources, b.Sources...)
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+// ====================== ASS GENERATOR ======================
+
+const assScriptInfo = `[Script Info]
+; Script generated by Limesub v2
+; https://t.me/s/limenime
+; https://www.facebook.com/limenime.official
+; https://discord.gg/7XS7MCvVwh
+; https://x.com/limenime
+%s
+Title: Default Limenime Subtitle File
+ScriptType: v4.00+
+WrapStyle: 0
+ScaledBorderAndShadow: yes
+YCbCr Matrix: None
+PlayResX: 1920
+PlayResY: 1080
+Timer: 100.0000
+
+`
+
+const assStylesHeader = `[V4+ Styles]
+Format: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, OutlineColour, BackColour, Bold, Italic, Underline, StrikeOut, ScaleX, ScaleY, Spacing, Angle, BorderStyle, Outline, Shadow, Alignment, MarginL, MarginR, MarginV, Encoding
+`
+
+const assEventsHeader = `
+[Events]
+Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text
+`
+
+func assStyles(opts Options) []string {
+	secondary := "&H00FFFFFF"
+	if opts.KaraokeSecondary != "" {
+		secondary = opts.KaraokeSecondary
+	}
+	return []string{
+		fmt.Sprintf("Style: Default,%s,70,&H00FFFFFF,%s,&H00000000,&H80000000,0,0,0,0,100,100,0,0,1,1.5,1,2,%d,%d,%d,1", opts.font(), secondary, opts.MarginL, opts.MarginR, opts.MarginV),
+		fmt.Sprintf("Style: tanda,%s,75,&H00FFFFFF,&H000000FF,&H00000000,&H00000000,-1,0,0,0,100,100,0,0,1,1,0,8,%d,%d,%d,1", opts.font(), opts.TandaMarginL, opts.TandaMarginR, opts.TandaMarginV),
+	}
+}
+
+var reHexColor = regexp.MustCompile(`^#?([0-9A-Fa-f]{6})$`)
+var reASSColor = regexp.MustCompile(`^&[Hh]([0-9A-Fa-f]{6}|[0-9A-Fa-f]{8})&?$`)
+
+// parseASSColor accepts #RRGGBB or an ASS &HBBGGRR / &HAABBGGRR value and
+// returns it in the &HAABBGGRR form style lines use.
+func parseASSColor(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if m := reHexColor.FindStringSubmatch(s); m != nil {
+		rgb := strings.ToUpper(m[1])
+		return "&H00" + rgb[4:6] + rgb[2:4] + rgb[0:2], nil
+	}
+	if m := reASSColor.FindStringSubmatch(s); m != nil {
+		return "&H" + strings.ToUpper(fmt.Sprintf("%08s", m[1])), nil
+	}
+	return "", fmt.Errorf("warna tidak valid: %q (gunakan #RRGGBB atau &HBBGGRR)", s)
+}
+
+// requiredFontsComment lists the fonts the given Style lines need, so whoever
+// opens the file knows what to install.
+func requiredFontsComment(styles []string) string {
+	var fonts []string
+	seen := map[string]bool{}
+	for _, st := range styles {
+		fields := strings.Split(strings.TrimPrefix(st, "Style:"), ",")
+		if len(fields) < 2 {
+			continue
+		}
+		name := strings.TrimSpace(fields[1])
+		if name != "" && !seen[name] {
+			seen[name] = true
+			fonts = append(fonts, name)
+		}
+	}
+	return "; Font yang dibutuhkan: " + strings.Join(fonts, ", ")
+}
+
+// privateFlags are left out of conversionComment: they hold local paths or
+// commands rather than settings that shape the subtitle. -template and
+// -style-config do shape it, so they are recorded by file name only.
+var privateFlags = map[string]bool{"outdir": true, "template": true, "style-config": true, "post-cmd": true}
+
+// conversionComment records the input format and every flag that differs
+// from its default, e.g. "; Dikonversi dari: srt, -tolerance 0.5 -blur 0".
+func conversionComment(opts Options) string {
+	cur, def := flag.NewFlagSet("", flag.ContinueOnError), flag.NewFlagSet("", flag.ContinueOnError)
+	BindFlags(cur, &opts)
+	d := DefaultOptions()
+	BindFlags(def, &d)
+	var set []string
+	add := func(name, v string) {
+		if strings.ContainsAny(v, " \t\"") || v == "" {
+			v = strconv.Quote(v)
+		}
+		set = append(set, "-"+name+" "+v)
+	}
+	cur.VisitAll(func(f *flag.Flag) {
+		v := f.Value.String()
+		if privateFlags[f.Name] || v == def.Lookup(f.Name).Value.String() {
+			return
+		}
+		add(f.Name, v)
+	})
+	if opts.TemplatePath != "" {
+		add("template", filepath.Base(opts.TemplatePath))
+	}
+	if opts.StyleConfig != "" {
+		add("style-config", filepath.Base(opts.StyleConfig))
+	}
+	from := opts.sourceFormat
+	if from == "" {
+		from = "?"
+	}
+	if len(set) == 0 {
+		return "; Dikonversi dari: " + from + " (opsi bawaan)"
+	}
+	return "; Dikonversi dari: " + from + ", " + strings.Join(set, " ")
+}
+
+// ====================== ASS TEMPLATE ======================
+
+// assTemplate carries the header and styling kit of a group's own .ass file,
+// applied to converted (non-ASS) input via -template.
+type assTemplate struct {
+	Info        []string
+	StyleFormat string
+	Styles      []string
+	Effects     map[string]string // per-style line prefix from -style-config
+}
+
+func loadTemplate(path string) (*assTemplate, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	_, sections := splitASSSections(strings.ReplaceAll(string(data), "\r", ""))
+	sections, err = mergeDuplicateSections(sections)
+	if err != nil {
+		return nil, err
+	}
+	t := &assTemplate{}
+	if info := findSection(sections, "Script Info"); info != nil {
+		t.Info = trimTrailingBlank(info.Lines)
+	}
+	if st := findSection(sections, "V4+ Styles"); st != nil {
+		for _, l := range st.Lines {
+			switch {
+			case strings.HasPrefix(l, "Format:"):
+				t.StyleFormat = l
+			case strings.HasPrefix(l, "Style:"):
+				t.Styles = append(t.Styles, l)
+			}
+		}
+	}
+	if len(t.Styles) == 0 {
+		return nil, fmt.Errorf("template %s tidak memiliki Style", filepath.Base(path))
+	}
+	if t.StyleFormat == "" {
+		t.StyleFormat = strings.Split(assStylesHeader, "\n")[1]
+	}
+	return t, nil
+}
+
+// loadStyleConfig reads a -style-config JSON file:
+//
+//	{
+//	  "styles": ["Style: Default,Arial,70,...", "Style: Sign,..."],
+//	  "effects": {"Default": "{\\blur3}{\\fad(00,40)}", "Sign": ""}
+//	}
+//
+// "styles" replaces the [V4+ Styles] block and "effects" the tag prefix put
+// in front of each line of that style; the Script Info header stays built in.
+func loadStyleConfig(path string) (*assTemplate, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg struct {
+		Format  string            `json:"format"`
+		Styles  []string          `json:"styles"`
+		Effects map[string]string `json:"effects"`
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	t := &assTemplate{StyleFormat: cfg.Format, Effects: cfg.Effects}
+	for _, st := range cfg.Styles {
+		st = strings.TrimSpace(st)
+		if !strings.HasPrefix(st, "Style:") {
+			st = "Style: " + st
+		}
+		t.Styles = append(t.Styles, st)
+	}
+	if len(t.Styles) == 0 {
+		return nil, fmt.Errorf("%s tidak memiliki styles", filepath.Base(path))
+	}
+	if t.StyleFormat == "" {
+		t.StyleFormat = strings.Split(assStylesHeader, "\n")[1]
+	}
+	return t, nil
+}
+
+// effectFor returns the -style-config effect prefix for a style name; ok is
+// false when the config doesn't mention it (or there is no config).
+func (t *assTemplate) effectFor(style string) (fx string, ok bool) {
+	if t == nil {
+		return "", false
+	}
+	for name, v := range t.Effects {
+		if strings.EqualFold(name, style) {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// styleFor maps a detected style (Default/tanda) onto the template's names:
+// an exact match first, then a sign-like name for tanda, then the first style.
+func (t *assTemplate) styleFor(detected string) string {
+	var names []string
+	for _, st := range t.Styles {
+		name, _ := styleName(st)
+		names = append(names, name)
+	}
+	for _, n := range names {
+		if strings.EqualFold(n, detected) {
+			return n
+		}
+	}
+	if detected == "tanda" {
+		for _, n := range names {
+			l := strings.ToLower(n)
+			if strings.Contains(l, "sign") || strings.Contains(l, "tanda") || l == "ts" {
+				return n
+			}
+		}
+	}
+	for _, n := range names {
+		if strings.EqualFold(n, "Default") {
+			return n
+		}
+	}
+	return names[0]
+}
+
+func generateASS(blocks []SRTBlock, opts Options) string {
+	styles := assStyles(opts)
+	template := opts.template
+	var buf strings.Builder
+	if template != nil && len(template.Info) == 0 {
+		styles = template.Styles
+		buf.WriteString(fmt.Sprintf(assScriptInfo, requiredFontsComment(styles)+"\n"+conversionComment(opts)))
+		buf.WriteString("[V4+ Styles]\n" + template.StyleFormat + "\n")
+	} else if template != nil {
+		styles = template.Styles
+		buf.WriteString("[Script Info]\n" + requiredFontsComment(styles) + "\n" + conversionComment(opts) + "\n")
+		for _, l := range template.Info {
+			if strings.HasPrefix(l, "; Font yang dibutuhkan:") || strings.HasPrefix(l, "; Dikonversi dari:") {
+				continue
+			}
+			buf.WriteString(l + "\n")
+		}
+		buf.WriteString("\n[V4+ Styles]\n" + template.StyleFormat + "\n")
+	} else {
+		buf.WriteString(fmt.Sprintf(assScriptInfo, requiredFontsComment(styles)+"\n"+conversionComment(opts)))
+		buf.WriteString(assStylesHeader)
+	}
+	for _, st := range styles {
+		buf.WriteString(st + "\n")
+	}
+	buf.WriteString(assEventsHeader)
+	for _, b := range blocks {
+		start := formatTimeASS(b.Start)
+		end := formatTimeASS(b.End)
+		text := strings.ReplaceAll(htmlStyleToASS(stripFontTags(b.Text)), "\n", "\\N")
+		if b.Style == "tanda" && opts.CollapseTanda {
+			text = joinLines(text)
+		}
+		if opts.CollapseSpaces {
+			text = collapseSpaces(text)
+		}
+		if b.Style == "tanda" {
+			text = changeCase(text, opts.TandaCase)
+		}
+		text = escapeLiteralBraces(text)
+		style := b.Style
+		if template != nil {
+			style = template.styleFor(b.Style)
+		}
+		if fx, ok := template.effectFor(style); ok {
+			text = withEffects(fx, text)
+		} else if b.Style != "tanda" {
+			text = withEffects(effectTags(opts, b.End-b.Start), text)
+		}
+		if opts.Annotate {
+			buf.WriteString(fmt.Sprintf("Comment: %d,%s,%s,%s,,0,0,0,,source: %s\n", b.Layer, start, end, style, joinInts(b.Sources)))
+		}
+		buf.WriteString(fmt.Sprintf("Dialogue: %d,%s,%s,%s,,0,0,0,,%s\n", b.Layer, start, end, style, text))
+	}
+	return buf.String()
+}
+
+// effectTags builds the {\blur}{\fad} prefix added to dialogue lines from
+// -blur, -fade-in and -fade-out; a zero value leaves its tag out. With
+// -adaptive-fade both fades come from dur instead, see adaptiveFade.
+func effectTags(opts Options, dur time.Duration) string {
+	var tags string
+	if opts.Blur > 0 {
+		tags += "{\\blur" + fmtNum(opts.Blur) + "}"
+	}
+	fadeIn, fadeOut := opts.FadeIn, opts.FadeOut
+	if opts.AdaptiveFade > 0 {
+		fadeIn = adaptiveFade(dur, opts.AdaptiveFade, opts.FadeMin, opts.FadeMax)
+		fadeOut = fadeIn
+	}
+	if fadeIn > 0 || fadeOut > 0 {
+		tags += fmt.Sprintf("{\\fad(%02d,%02d)}", fadeIn, fadeOut)
+	}
+	return tags
+}
+
+// adaptiveFade returns percent of dur in ms, kept within [min, max] and never
+// more than half the cue so fade in and out don't overlap.
+func adaptiveFade(dur time.Duration, percent float64, min, max int) int {
+	ms := int(math.Round(float64(dur.Milliseconds()) * percent / 100))
+	if ms < min {
+		ms = min
+	}
+	if ms > max {
+		ms = max
+	}
+	if half := int(dur.Milliseconds() / 2); ms > half {
+		ms = half
+	}
+	return ms
+}
+
+// withEffects puts the effect tags in front of text. When the text already
+// opens with an override block (an SRT carrying {\an8}, say) they go inside
+// that block, before its own tags, so the line keeps a single leading block
+// and the source tags win on conflicts.
+func withEffects(effects, text string) string {
+	if effects == "" {
+		return text
+	}
+	if loc := reTagBlock.FindStringIndex(text); loc != nil && loc[0] == 0 {
+		inner := strings.ReplaceAll(strings.TrimSuffix(strings.TrimPrefix(effects, "{"), "}"), "}{", "")
+		return "{" + inner + strings.TrimLeft(text[1:], " ")
+	}
+	return effects + text
+}
+
+func joinInts(ns []int) string {
+	parts := make([]string, len(ns))
+	for i, n := range ns {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, ",")
+}
+
+// sortEvents orders the final events: by start (default), by end time, or by
+// layer then start for layered typesetting.
+func sortEvents(blocks []SRTBlock, by string) error {
+	switch by {
+	case "", "start":
+		sort.SliceStable(blocks, func(i, j int) bool { return blocks[i].Start < blocks[j].Start })
+	case "end":
+		sort.SliceStable(blocks, func(i, j int) bool {
+			if blocks[i].End != blocks[j].End {
+				return blocks[i].End < blocks[j].End
+			}
+			return blocks[i].Start < blocks[j].Start
+		})
+	case "layer":
+		sort.SliceStable(blocks, func(i, j int) bool {
+			if blocks[i].Layer != blocks[j].Layer {
+				return blocks[i].Layer < blocks[j].Layer
+			}
+			return blocks[i].Start < blocks[j].Start
+		})
+	default:
+		return fmt.Errorf("nilai -sort-by tidak dikenal: %q (gunakan start, end, atau layer)", by)
+	}
+	return nil
+}
+
+func formatTimeASS(t time.Duration) string {
+	// ASS only has centiseconds; round rather than truncate so the error
+	// stays within 5ms, carrying into the seconds (0.995s -> 0:00:01.00)
+	t = t.Round(10 * time.Millisecond)
+	if t < 0 {
+		t = 0
+	}
+	h := int(t.Hours())
+	m := int(t.Minutes()) % 60
+	s := int(t.Seconds()) % 60
+	cs := int(t.Milliseconds()/10) % 100
+	return fmt.Sprintf("%d:%02d:%02d.%02d", h, m, s, cs)
+}
+
+// ====================== SRT GENERATOR ======================
+
+// RenumberBlocks reassigns Index sequentially from 1, e.g. after merges or
+// edits changed the number of blocks.
+func RenumberBlocks(blocks []SRTBlock) {
+	for i := range blocks {
+		blocks[i].Index = i + 1
+	}
+}
+
+// generateSRT writes plain SRT with override tags stripped and cues numbered
+// from 1. The blocks' own Index fields are left as they are.
+func generateSRT(blocks []SRTBlock) string {
+	var buf strings.Builder
+	for i, b := range blocks {
+		buf.WriteString(fmt.Sprintf("%d\n%s --> %s\n%s\n\n", i+1, formatTimeSRT(b.Start), formatTimeSRT(b.End), keepHTMLStyleTags(plainText(b.Text), "biu")))
+	}
+	return buf.String()
+}
+
+// reTagBlock matches override blocks but not literal "{text}" in dialogue.
+var reTagBlock = regexp.MustCompile(`\{\s*\\[^}]*\}`)
+
+// joinLines puts a multi-line sign on one line, joining its lines with a
+// space instead of \N.
+func joinLines(s string) string {
+	var parts []string
+	for _, l := range reLineBreak.Split(s, -1) {
+		if l = strings.TrimSpace(l); l != "" {
+			parts = append(parts, l)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// plainText drops ASS override blocks and turns \N / \h into a newline and a
+// space, for output formats that don't understand ASS markup.
+func plainText(s string) string {
+	s = reTagBlock.ReplaceAllString(stripFontTags(s), "")
+	s = strings.NewReplacer("\\N", "\n", "\\n", "\n", "\\h", " ").Replace(s)
+	return s
+}
+
+// keepHTMLStyleTags removes the <b>/<i>/<s>/<u> tags whose letter is not in
+// keep, for outputs that only understand some of them (no <s> in SRT or VTT),
+// and lowercases the rest since VTT tags are case-sensitive.
+func keepHTMLStyleTags(s, keep string) string {
+	return reHTMLStyleTag.ReplaceAllStringFunc(s, func(m string) string {
+		if strings.Contains(keep, strings.ToLower(reHTMLStyleTag.FindStringSubmatch(m)[2])) {
+			return strings.ToLower(m)
+		}
+		return ""
+	})
+}
+
+func formatTimeSRT(t time.Duration) string {
+	h := int(t.Hours())
+	m := int(t.Minutes()) % 60
+	s := int(t.Seconds()) % 60
+	ms := int(t.Milliseconds()) % 1000
+	return fmt.Sprintf("%02d:%02d:%02d,%03d", h, m, s, ms)
+}
+
+// ====================== VTT GENERATOR ======================
+
+// generateVTT writes a WebVTT file: header, then the cues in start order with
+// override tags stripped.
+func generateVTT(blocks []SRTBlock) string {
+	sorted := append([]SRTBlock(nil), blocks...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Start < sorted[j].Start })
+	var buf strings.Builder
+	buf.WriteString("WEBVTT\n\n")
+	for _, b := range sorted {
+		// a blank line would end the cue early
+		text := strings.TrimSpace(reBlankLines.ReplaceAllString(keepHTMLStyleTags(plainText(b.Text), "biu"), "\n"))
+		buf.WriteString(fmt.Sprintf("%s --> %s\n%s\n\n", formatTimeVTT(b.Start), formatTimeVTT(b.End), text))
+	}
+	return buf.String()
+}
+
+var reBlankLines = regexp.MustCompile(`\n\s*\n`)
+
+func formatTimeVTT(t time.Duration) string {
+	return strings.Replace(formatTimeSRT(t), ",", ".", 1)
+}
+
+// ====================== OUTPUT HANDLER ======================
+
+// reservedOutputs holds the names nextOutputPath has handed out and whose
+// files aren't written yet, so callers converting in parallel into one
+// -outdir never get the same (N) before either file exists on disk.
+var reservedOutputs = struct {
+	sync.Mutex
+	names map[string]bool
+}{names: map[string]bool{}}
+
+// nextOutputPath returns <name>_Limenime<ext> in outdir (next to the input
+// when outdir is ""), numbered (1), (2), ... when that file already exists
+// or was already handed out. Callers release the name with releaseOutputPath
+// once the file is written. Safe for concurrent use.
+func nextOutputPath(input, outdir, ext string) string {
+	dir := outdir
+	if dir == "" {
+		dir = filepath.Dir(input)
+	}
+	base := strings.TrimSuffix(filepath.Base(input), filepath.Ext(input))
+
+	reservedOutputs.Lock()
+	defer reservedOutputs.Unlock()
+	taken := func(p string) bool {
+		if reservedOutputs.names[filepath.Clean(p)] {
+			return true
+		}
+		_, err := os.Stat(p)
+		return err == nil
+	}
+	out := filepath.Join(dir, base+"_Limenime"+ext)
+	for i := 1; taken(out); i++ {
+		out = filepath.Join(dir, fmt.Sprintf("%s_Limenime(%d)%s", base, i, ext))
+	}
+	reservedOutputs.names[filepath.Clean(out)] = true
+	return out
+}
+
+// releaseOutputPath forgets a name from nextOutputPath. After a successful
+// write the file itself keeps the name taken; after a failed one it is free
+// again.
+func releaseOutputPath(out string) {
+	reservedOutputs.Lock()
+	delete(reservedOutputs.names, filepath.Clean(out))
+	reservedOutputs.Unlock()
+}
+
+// refuseOverwrite errors when output names the input file itself, so a
+// bad output path can never replace the source subtitle.
+func refuseOverwrite(input, output string) error {
+	same := filepath.Clean(input) == filepath.Clean(output)
+	if !same {
+		a, errA := os.Stat(input)
+		b, errB := os.Stat(output)
+		same = errA == nil && errB == nil && os.SameFile(a, b)
+	}
+	if same {
+		return fmt.Errorf("output %s sama dengan file input; file sumber tidak akan ditimpa", filepath.Base(output))
+	}
+	return nil
+}
+
+// encodeOutput transcodes the UTF-8 output to the -output-encoding charset
+// (e.g. shift_jis, gbk). Characters the charset can't hold are replaced by its
+// substitution byte rather than failing the whole file.
+func encodeOutput(s string, opts Options) ([]byte, error) {
+	charset := opts.OutputEncoding
+	if isUTF8Label(charset) {
+		return []byte(s), nil
+	}
+	enc, err := htmlindex.Get(strings.ToLower(strings.TrimSpace(charset)))
+	if err != nil {
+		return nil, fmt.Errorf("encoding output tidak dikenal: %q", charset)
+	}
+	if out, err := enc.NewEncoder().String(s); err == nil {
+		return []byte(out), nil
+	}
+	opts.logf("⚠️ Sebagian karakter tidak bisa ditulis dalam %s dan diganti karakter pengganti\n", charset)
+	out, err := encoding.ReplaceUnsupported(enc.NewEncoder()).String(s)
+	return []byte(out), err
+}
+
+// writeOutput encodes content for -output-encoding and writes it to path, or
+// to stdout when path is StdioPath.
+func writeOutput(path, content string, opts Options) error {
+	data, err := encodeOutput(content, opts)
+	if err != nil {
+		return err
+	}
+	if path == StdioPath {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(path, data, fs.ModePerm)
+}
@@ -0,0 +1,1049 @@
+package limesub
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func ms(n int) time.Duration { return time.Duration(n) * time.Millisecond }
+
+type cue struct {
+	Start, End time.Duration
+	Text       string
+}
+
+func cues(blocks []SRTBlock) []cue {
+	out := make([]cue, 0, len(blocks))
+	for _, b := range blocks {
+		out = append(out, cue{b.Start, b.End, b.Text})
+	}
+	return out
+}
+
+func TestSortEvents(t *testing.T) {
+	input := []SRTBlock{
+		{Start: ms(0), End: ms(5000), Text: "long sign", Layer: 1},
+		{Start: ms(1000), End: ms(2000), Text: "short"},
+		{Start: ms(500), End: ms(2000), Text: "same end, earlier start"},
+		{Start: ms(3000), End: ms(4000), Text: "late", Layer: 1},
+	}
+	tests := []struct {
+		by   string
+		want []string
+	}{
+		{"start", []string{"long sign", "same end, earlier start", "short", "late"}},
+		{"end", []string{"same end, earlier start", "short", "late", "long sign"}},
+		{"layer", []string{"same end, earlier start", "short", "long sign", "late"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.by, func(t *testing.T) {
+			blocks := append([]SRTBlock(nil), input...)
+			if err := sortEvents(blocks, tt.by); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, b := range blocks {
+				got = append(got, b.Text)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+	if err := sortEvents(input, "bogus"); err == nil {
+		t.Error("want an error for an unknown order")
+	}
+}
+
+func TestParseJSONTimeUnit(t *testing.T) {
+	data, err := os.ReadFile("testdata/seconds.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	seconds := []cue{
+		{ms(1500), ms(3250), "First line"},
+		{ms(4000), ms(5500), "Second line"},
+		{ms(12125), ms(14000), "Third line"},
+	}
+	tests := []struct {
+		unit string
+		want []cue
+	}{
+		{"auto", seconds},
+		{"s", seconds},
+		{"ms", []cue{
+			{ms(1), ms(3), "First line"},
+			{ms(4), ms(5), "Second line"},
+			{ms(12), ms(14), "Third line"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.unit, func(t *testing.T) {
+			blocks, warns, err := parseJSONtoSRT(data, tt.unit, 0)
+			if err != nil || len(warns) > 0 {
+				t.Fatalf("warns %v, err %v", warns, err)
+			}
+			got := cues(blocks)
+			for i := range got {
+				got[i].Start = got[i].Start.Truncate(time.Millisecond)
+				got[i].End = got[i].End.Truncate(time.Millisecond)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v\nwant %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCollapseSpaces(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"two  spaces", "two spaces"},
+		{"tab\t and  space", "tab and space"},
+		{"{\\fn  Arial}keep  tag", "{\\fn  Arial}keep tag"},
+		{"a  {\\i1}b  c{\\i0}  d", "a {\\i1}b c{\\i0} d"},
+		{"single spaces", "single spaces"},
+	}
+	for _, tt := range tests {
+		if got := collapseSpaces(tt.in); got != tt.want {
+			t.Errorf("collapseSpaces(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseTTMLBrInSpan(t *testing.T) {
+	data, err := os.ReadFile("testdata/br_span.ttml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks, warns, err := parseTTMLtoSRT(data, false)
+	if err != nil || len(warns) > 0 {
+		t.Fatalf("warns %v, err %v", warns, err)
+	}
+	want := []string{"A\nB", "Left\nright side", "One\nTwo\nThree"}
+	var got []string
+	for _, b := range blocks {
+		got = append(got, stripFontTags(b.Text))
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestParseTimeFullWidth(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+	}{
+		{"００：００：０１，５００", 1500},
+		{"００:０１:０２.２５０", 62250},
+		{"0１:00:00,000", 3600000},
+		{"００：００：０１,000", 1000},
+	}
+	for _, tt := range tests {
+		got, err := parseTimeStringToMs(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("parseTimeStringToMs(%q) = %d, %v; want %d", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseArrowSpacing(t *testing.T) {
+	want := []cue{
+		{ms(1000), ms(2000), "No spaces"},
+		{ms(3000), ms(4000), "Wide spaces"},
+		{ms(5000), ms(6000), "Tabs"},
+	}
+	tests := []struct {
+		file  string
+		parse func(string) ([]SRTBlock, []Warning)
+	}{
+		{"testdata/arrows.srt", func(s string) ([]SRTBlock, []Warning) { return parseSRTString(s, nil) }},
+		{"testdata/arrows.vtt", parseVTTToSRT},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			data, err := os.ReadFile(tt.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			blocks, warns := tt.parse(string(data))
+			if len(warns) > 0 {
+				t.Fatalf("warns %v", warns)
+			}
+			if got := cues(blocks); !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v\nwant %v", got, want)
+			}
+		})
+	}
+}
+
+func TestParseJSONEmptySegs(t *testing.T) {
+	data, err := os.ReadFile("testdata/empty_segs.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks, warns, err := parseJSONtoSRT(data, "auto", 0)
+	if err != nil || len(warns) > 0 {
+		t.Fatalf("warns %v, err %v", warns, err)
+	}
+	want := []cue{
+		{ms(1000), ms(2500), "First"},
+		{ms(3000), ms(4000), "Second"},
+		{ms(6000), ms(7000), "Third"},
+	}
+	if got := cues(blocks); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v\nwant %v", got, want)
+	}
+}
+
+func TestCapDurations(t *testing.T) {
+	blocks := []SRTBlock{
+		{Start: ms(1000), End: ms(31000), Text: "runaway"},
+		{Start: ms(40000), End: ms(47000), Text: "exactly the cap"},
+		{Start: ms(50000), End: ms(52000), Text: "short"},
+	}
+	if n := capDurations(blocks, 7*time.Second); n != 1 {
+		t.Errorf("capped %d cues, want 1", n)
+	}
+	want := []cue{
+		{ms(1000), ms(8000), "runaway"},
+		{ms(40000), ms(47000), "exactly the cap"},
+		{ms(50000), ms(52000), "short"},
+	}
+	if got := cues(blocks); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v\nwant %v", got, want)
+	}
+}
+
+func TestParseSRTWhitespaceSeparators(t *testing.T) {
+	data, err := os.ReadFile("testdata/space_separators.srt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks, warns := parseSRTString(string(data), nil)
+	if len(warns) > 0 {
+		t.Fatalf("warns %v", warns)
+	}
+	want := []cue{
+		{ms(1000), ms(2000), "First"},
+		{ms(3000), ms(4000), "Second"},
+		{ms(5000), ms(6000), "Third"},
+		{ms(7000), ms(8000), "Fourth"},
+	}
+	if got := cues(blocks); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v\nwant %v", got, want)
+	}
+}
+
+func TestMergeMaxDuration(t *testing.T) {
+	// a sign shown for 9.5s every 10s over two minutes
+	var blocks []SRTBlock
+	for k := 0; k < 12; k++ {
+		blocks = append(blocks, SRTBlock{Start: ms(k * 10000), End: ms(k*10000 + 9500), Text: "SIGN", Style: "tanda"})
+	}
+	tests := []struct {
+		name   string
+		maxDur time.Duration
+		want   []cue
+	}{
+		{"no cap", 0, []cue{{0, ms(119500), "SIGN"}}},
+		{"60s cap", 60 * time.Second, []cue{{0, ms(59500), "SIGN"}, {ms(60000), ms(119500), "SIGN"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := append([]SRTBlock(nil), blocks...)
+			got := cues(mergeSameOrContinuous(in, time.Second, tt.maxDur, false))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v\nwant %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuditTimeJumps(t *testing.T) {
+	data, err := os.ReadFile("testdata/time_jump.srt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks, warns := parseSRTString(string(data), nil)
+	if len(warns) > 0 {
+		t.Fatalf("warns %v", warns)
+	}
+	got := auditTimeJumps(blocks)
+	if len(got) != 1 || got[0].Index != 4 || !strings.Contains(got[0].Msg, "50:00:10,000") {
+		t.Errorf("auditTimeJumps = %v, want one warning for cue 4 at 50:00:10,000", got)
+	}
+	if got := auditTimeJumps(blocks[:3]); len(got) != 0 {
+		t.Errorf("evenly spaced cues flagged: %v", got)
+	}
+}
+
+func TestParseTTMLSpans(t *testing.T) {
+	data, err := os.ReadFile("testdata/spans.ttml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		spans bool
+		want  []cue
+	}{
+		{"paragraphs", false, []cue{
+			{ms(1000), ms(4000), "Hello world"},
+			{ms(5000), ms(8000), "(whispers)\nquietly"},
+			{ms(9000), ms(10000), "No spans here"},
+			{ms(11000), ms(14000), "Outer red inner & more"},
+		}},
+		{"timed spans", true, []cue{
+			{ms(1000), ms(2000), "Hello"},
+			{ms(2000), ms(3500), "world"},
+			{ms(5000), ms(8000), "(whispers)"},
+			{ms(5500), ms(8000), "quietly"},
+			{ms(9000), ms(10000), "No spans here"},
+			{ms(11000), ms(14000), "Outer red & more"},
+			{ms(12000), ms(13000), "inner"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocks, warns, err := parseTTMLtoSRT(data, tt.spans)
+			if err != nil || len(warns) > 0 {
+				t.Fatalf("warns %v, err %v", warns, err)
+			}
+			if got := cues(blocks); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v\nwant %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeAlignmentTags(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"{\\a6}top centre", "{\\an8}top centre"},
+		{"{\\a5}top left", "{\\an7}top left"},
+		{"{\\a2}bottom", "{\\an2}bottom"},
+		{"{\\a10}middle", "{\\an5}middle"},
+		{"{\\b1\\a11}mixed", "{\\b1\\an6}mixed"},
+		{"{\\an8}already numpad", "{\\an8}already numpad"},
+		{"{\\alpha&H80&}not alignment", "{\\alpha&H80&}not alignment"},
+		{"{\\a4}unknown", "{\\a4}unknown"},
+		{"plain \\a5 outside a tag", "plain \\a5 outside a tag"},
+	}
+	for _, tt := range tests {
+		if got := normalizeAlignmentTags(tt.in); got != tt.want {
+			t.Errorf("normalizeAlignmentTags(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMergeSameStartDifferentEnd(t *testing.T) {
+	tests := []struct {
+		name      string
+		tolerance time.Duration
+	}{
+		{"merging off", 0},
+		{"merging on", 500 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocks := []SRTBlock{
+				{Start: ms(1000), End: ms(2000), Text: "Wait!", Style: "Default", Sources: []int{1}},
+				{Start: ms(1000), End: ms(3500), Text: "Wait!", Style: "Default", Sources: []int{2}},
+				{Start: ms(1000), End: ms(1500), Text: "Wait!", Style: "Default", Sources: []int{3}},
+				{Start: ms(5000), End: ms(6000), Text: "Next", Style: "Default", Sources: []int{4}},
+			}
+			got := mergeSameOrContinuous(blocks, tt.tolerance, 0, false)
+			want := []cue{{ms(1000), ms(3500), "Wait!"}, {ms(5000), ms(6000), "Next"}}
+			if !reflect.DeepEqual(cues(got), want) {
+				t.Fatalf("got %v\nwant %v", cues(got), want)
+			}
+			if !reflect.DeepEqual(got[0].Sources, []int{1, 2, 3}) {
+				t.Errorf("sources = %v, want [1 2 3]", got[0].Sources)
+			}
+		})
+	}
+}
+
+func TestRenumberBlocksAfterMerge(t *testing.T) {
+	blocks, _ := parseSRTString("3\n00:00:01,000 --> 00:00:02,000\nAgain\n\n"+
+		"7\n00:00:02,200 --> 00:00:03,000\nAgain\n\n"+
+		"8\n00:00:04,000 --> 00:00:05,000\nOnce\n\n"+
+		"12\n00:00:05,100 --> 00:00:06,000\nAgain\n", nil)
+	blocks = mergeSameOrContinuous(blocks, 500*time.Millisecond, 0, false)
+	RenumberBlocks(blocks)
+	var got []int
+	for _, b := range blocks {
+		got = append(got, b.Index)
+	}
+	if want := []int{1, 2, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("indices = %v, want %v", got, want)
+	}
+	srt := generateSRT(blocks)
+	if want := "1\n00:00:01,000 --> 00:00:03,000\nAgain\n\n2\n00:00:04,000 --> 00:00:05,000\nOnce\n\n3\n00:00:05,100 --> 00:00:06,000\nAgain\n\n"; srt != want {
+		t.Errorf("generateSRT = %q, want %q", srt, want)
+	}
+}
+
+func TestGenerateSRTLeavesIndices(t *testing.T) {
+	blocks := []SRTBlock{
+		{Index: 4, Start: ms(1000), End: ms(2000), Text: "A"},
+		{Index: 9, Start: ms(3000), End: ms(4000), Text: "B"},
+	}
+	if got, want := generateSRT(blocks), "1\n00:00:01,000 --> 00:00:02,000\nA\n\n2\n00:00:03,000 --> 00:00:04,000\nB\n\n"; got != want {
+		t.Errorf("generateSRT = %q, want %q", got, want)
+	}
+	if blocks[0].Index != 4 || blocks[1].Index != 9 {
+		t.Errorf("caller's indices changed to %d, %d", blocks[0].Index, blocks[1].Index)
+	}
+}
+
+func TestParseVTTNamedCuesAndRegions(t *testing.T) {
+	data, err := os.ReadFile("testdata/named_cues.vtt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks, warns := parseVTTToSRT(string(data))
+	if len(warns) > 0 {
+		t.Fatalf("warns %v", warns)
+	}
+	want := []cue{
+		{ms(1000), ms(3000), "Long ago,\nin a distant land"},
+		{ms(4000), ms(5500), "Numbered id"},
+		{ms(6000), ms(7000), "No identifier & an entity"},
+		{ms(8000), ms(9000), "TOKYO STATION"},
+	}
+	if got := cues(blocks); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v\nwant %v", got, want)
+	}
+}
+
+func TestParseSRTIndexReset(t *testing.T) {
+	data, err := os.ReadFile("testdata/index_reset.srt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks, warns := parseSRTString(string(data), nil)
+	if len(warns) > 0 {
+		t.Fatalf("warns %v", warns)
+	}
+	want := []cue{
+		{ms(500), ms(900), "Early cue listed last"},
+		{ms(1000), ms(2000), "Part one, first"},
+		{ms(3000), ms(4000), "Part one, second"},
+		{ms(5000), ms(6000), "Part two, first"},
+		{ms(7000), ms(8000), "Part two, second"},
+		{ms(9000), ms(10000), "Duplicated index"},
+	}
+	if got := cues(blocks); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v\nwant %v", got, want)
+	}
+	if got := blocks[0].Sources; !reflect.DeepEqual(got, []int{6}) {
+		t.Errorf("first cue sources = %v, want its file position [6]", got)
+	}
+}
+
+func TestFixCPS(t *testing.T) {
+	const fast = "abcdefghij abcdefghij abcdefgh" // 30 characters: 2s at 15 CPS
+	tests := []struct {
+		name    string
+		next    SRTBlock
+		wantEnd time.Duration
+		wantN   int
+	}{
+		{"room to grow", SRTBlock{Start: ms(10000), End: ms(11000), Text: "later", Style: "Default"}, ms(3000), 1},
+		{"stops at the next cue", SRTBlock{Start: ms(2500), End: ms(4000), Text: "next", Style: "Default"}, ms(2500), 1},
+		{"other style doesn't block", SRTBlock{Start: ms(2500), End: ms(4000), Text: "SIGN", Style: "tanda"}, ms(3000), 1},
+		{"next cue right at the end", SRTBlock{Start: ms(2000), End: ms(4000), Text: "next", Style: "Default"}, ms(2000), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocks := []SRTBlock{{Start: ms(1000), End: ms(2000), Text: fast, Style: "Default"}, tt.next}
+			if n := fixCPS(blocks, 15); n != tt.wantN {
+				t.Errorf("fixCPS adjusted %d cues, want %d", n, tt.wantN)
+			}
+			if blocks[0].End != tt.wantEnd {
+				t.Errorf("end = %s, want %s", blocks[0].End, tt.wantEnd)
+			}
+			if blocks[1].End != tt.next.End {
+				t.Errorf("slow cue changed: end %s, want %s", blocks[1].End, tt.next.End)
+			}
+		})
+	}
+}
+
+func TestHTMLStyleToASS(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"<i>one line</i>", "{\\i1}one line{\\i0}"},
+		{"<i>line one\nline two</i>", "{\\i1}line one{\\i0}\n{\\i1}line two{\\i0}"},
+		{"<i>one\ntwo\nthree</i>", "{\\i1}one{\\i0}\n{\\i1}two{\\i0}\n{\\i1}three{\\i0}"},
+		{"plain <B>bold\nstill bold</B> done", "plain {\\b1}bold{\\b0}\n{\\b1}still bold{\\b0} done"},
+		{"<b><i>both\nlines</i></b>", "{\\b1}{\\i1}both{\\b0}{\\i0}\n{\\b1}{\\i1}lines{\\i0}{\\b0}"},
+		{"no tags\nhere", "no tags\nhere"},
+	}
+	for _, tt := range tests {
+		if got := htmlStyleToASS(tt.in); got != tt.want {
+			t.Errorf("htmlStyleToASS(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseJSONAppend(t *testing.T) {
+	data, err := os.ReadFile("testdata/append.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks, warns, err := parseJSONtoSRT(data, "auto", 0)
+	if err != nil || len(warns) > 0 {
+		t.Fatalf("warns %v, err %v", warns, err)
+	}
+	want := []cue{
+		{ms(1000), ms(6000), "first line\nrolls on\nand again"},
+		{ms(2600), ms(5600), "other window"},
+		{ms(7000), ms(8000), "fresh caption"},
+	}
+	if got := cues(blocks); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v\nwant %v", got, want)
+	}
+}
+
+func TestParseJSONWindowIDs(t *testing.T) {
+	data := []byte(`{"events": [
+  {"tStartMs": 1000, "dDurationMs": 1000, "wWinId": "top", "segs": [{"utf8": "named"}]},
+  {"tStartMs": 1200, "dDurationMs": 1000, "wWinId": [1], "segs": [{"utf8": "array"}]},
+  {"tStartMs": 1500, "dDurationMs": 1000, "wWinId": "top", "aAppend": 1, "segs": [{"utf8": "more"}]},
+  {"tStartMs": 1800, "dDurationMs": 1000, "wWinId": {"id": 1}, "aAppend": 1, "segs": [{"utf8": "object"}]}
+]}`)
+	blocks, warns, err := parseJSONtoSRT(data, "auto", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []cue{
+		{ms(1000), ms(2500), "named\nmore"},
+		{ms(1200), ms(2800), "array\nobject"},
+	}
+	if got := cues(blocks); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v\nwant %v", got, want)
+	}
+	if len(warns) != 2 || warns[0].Index != 2 || warns[1].Index != 4 {
+		t.Errorf("warns = %v, want one for each of events 2 and 4", warns)
+	}
+}
+
+func TestEscapeLiteralBraces(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"use {brackets}", "use \\{brackets\\}"},
+		{"{\\an8}top", "{\\an8}top"},
+		{"{\\i1}say {hi}{\\i0}", "{\\i1}say \\{hi\\}{\\i0}"},
+		{"{ \\b1}spaced tag", "{ \\b1}spaced tag"},
+		{"lonely } and {", "lonely \\} and \\{"},
+		{"{not {\\b1}a tag}", "\\{not {\\b1}a tag\\}"},
+		{"no braces", "no braces"},
+	}
+	for _, tt := range tests {
+		if got := escapeLiteralBraces(tt.in); got != tt.want {
+			t.Errorf("escapeLiteralBraces(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestClampGuessedEnds(t *testing.T) {
+	tests := []struct {
+		format, data string
+		want         []cue
+	}{
+		{"json", `[{"start": 1000, "text": "no end"}, {"start": 1500, "end": 4000, "text": "has end"},
+			{"start": 2000, "text": "overlapped but stated"}, {"start": 9000, "text": "last"}]`, []cue{
+			{ms(1000), ms(1500), "no end"},
+			{ms(1500), ms(4000), "has end"},
+			{ms(2000), ms(4000), "overlapped but stated"},
+			{ms(9000), ms(11000), "last"},
+		}},
+		{"ttml", `<tt xmlns="http://www.w3.org/ns/ttml"><body><div>
+			<p begin="1s">no end</p>
+			<p begin="1.8s" end="5s">has end</p>
+			<p begin="2s" end="3s">overlaps, stated</p>
+			<p begin="9s">last</p>
+			</div></body></tt>`, []cue{
+			{ms(1000), ms(1800), "no end"},
+			{ms(1800), ms(5000), "has end"},
+			{ms(2000), ms(3000), "overlaps, stated"},
+			{ms(9000), ms(11000), "last"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			blocks, warns, err := ConvertToSRT(tt.format, []byte(tt.data), DefaultOptions())
+			if err != nil || len(warns) > 0 {
+				t.Fatalf("warns %v, err %v", warns, err)
+			}
+			if got := cues(blocks); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v\nwant %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEffectTags(t *testing.T) {
+	tests := []struct {
+		name            string
+		blur            float64
+		fadeIn, fadeOut int
+		want            string
+	}{
+		{"defaults", 3, 0, 40, "{\\blur3}{\\fad(00,40)}"},
+		{"fractional blur", 0.8, 0, 40, "{\\blur0.8}{\\fad(00,40)}"},
+		{"no blur", 0, 120, 250, "{\\fad(120,250)}"},
+		{"no fade", 2, 0, 0, "{\\blur2}"},
+		{"fade in only", 0, 5, 0, "{\\fad(05,00)}"},
+		{"nothing", 0, 0, 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := Options{Blur: tt.blur, FadeIn: tt.fadeIn, FadeOut: tt.fadeOut}
+			if got := effectTags(opts, 2*time.Second); got != tt.want {
+				t.Errorf("effectTags = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTTMLDuration(t *testing.T) {
+	tests := []struct {
+		dur  string
+		want time.Duration
+	}{
+		{"2.5", ms(2500)},
+		{"1500", ms(1500 * 1000)}, // bare numbers are seconds in TTML, not the >1000 = ms guess
+		{"2.5s", ms(2500)},
+		{"2500ms", ms(2500)},
+		{"00:00:02.500", ms(2500)},
+		{" ２.５ ", ms(2500)},
+	}
+	for _, tt := range tests {
+		var w warnList
+		if got := ttmlDuration(&w, 1, tt.dur); got != tt.want || len(w) > 0 {
+			t.Errorf("ttmlDuration(%q) = %s, warns %v; want %s", tt.dur, got, w, tt.want)
+		}
+	}
+
+	data := `<tt xmlns="http://www.w3.org/ns/ttml"><body><div><p begin="1s" dur="2.5">x</p></div></body></tt>`
+	blocks, _, err := parseTTMLtoSRT([]byte(data), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []cue{{ms(1000), ms(3500), "x"}}; !reflect.DeepEqual(cues(blocks), want) {
+		t.Errorf("got %v, want %v", cues(blocks), want)
+	}
+}
+
+func TestChangeCase(t *testing.T) {
+	tests := []struct{ in, mode, want string }{
+		{"[Tokyo Station]", "upper", "[TOKYO STATION]"},
+		{"{\\fnArial\\c&Hffffff&}Café\\Nnext", "upper", "{\\fnArial\\c&Hffffff&}CAFÉ\\NNEXT"},
+		{"{\\an8}SHOUT\\hIT", "lower", "{\\an8}shout\\hit"},
+		{"Keep As Is", "none", "Keep As Is"},
+	}
+	for _, tt := range tests {
+		if got := changeCase(tt.in, tt.mode); got != tt.want {
+			t.Errorf("changeCase(%q, %s) = %q, want %q", tt.in, tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestDetectStyle(t *testing.T) {
+	tests := []struct{ text, want string }{
+		{"こんにちは", "Default"},
+		{"1234", "Default"},
+		{"HELLO", "tanda"},
+		{"Hello", "Default"},
+		{"「東京駅」", "Default"},
+		{"100%!", "Default"},
+		{"ÉCOLE", "tanda"},
+		{"ПРИВЕТ", "tanda"},
+		{"{\\an8}TOKYO", "tanda"},
+		{"<i>NARRATOR</i>", "tanda"},
+		{"(sighs)", "tanda"},
+		{"[Music]", "tanda"},
+		{"OK 2024年", "tanda"},
+		{"", "Default"},
+	}
+	for _, tt := range tests {
+		if got := detectStyle(tt.text); got != tt.want {
+			t.Errorf("detectStyle(%q) = %s, want %s", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestAdaptiveFade(t *testing.T) {
+	// 5% of the cue, between 10ms and 200ms, at most half the cue
+	tests := []struct {
+		dur  time.Duration
+		want int
+	}{
+		{ms(600), 30},
+		{ms(2000), 100},
+		{ms(10000), 200},
+		{ms(60000), 200},
+		{ms(100), 10},
+		{ms(16), 8},
+	}
+	for _, tt := range tests {
+		if got := adaptiveFade(tt.dur, 5, 10, 200); got != tt.want {
+			t.Errorf("adaptiveFade(%s) = %d, want %d", tt.dur, got, tt.want)
+		}
+	}
+
+	opts := DefaultOptions()
+	opts.AdaptiveFade = 5
+	if got := effectTags(opts, ms(600)); got != "{\\blur3}{\\fad(30,30)}" {
+		t.Errorf("short cue effect = %q", got)
+	}
+	if got := effectTags(opts, ms(30000)); got != "{\\blur3}{\\fad(200,200)}" {
+		t.Errorf("long cue effect = %q", got)
+	}
+}
+
+func TestFormatTimeASS(t *testing.T) {
+	tests := []struct {
+		in   time.Duration
+		want string
+	}{
+		{0, "0:00:00.00"},
+		{ms(994), "0:00:00.99"},
+		{ms(995), "0:00:01.00"},
+		{ms(999), "0:00:01.00"},
+		{ms(9995), "0:00:10.00"},
+		{ms(59995), "0:01:00.00"},
+		{ms(3599995), "1:00:00.00"},
+		{ms(3599994), "0:59:59.99"},
+		{ms(1234), "0:00:01.23"},
+		{ms(1235), "0:00:01.24"},
+		{ms(-3), "0:00:00.00"},
+	}
+	for _, tt := range tests {
+		if got := formatTimeASS(tt.in); got != tt.want {
+			t.Errorf("formatTimeASS(%s) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseTTMLIgnoresMetadata(t *testing.T) {
+	data, err := os.ReadFile("testdata/metadata.ttml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks, warns, err := parseTTMLtoSRT(data, false)
+	if err != nil || len(warns) > 0 {
+		t.Fatalf("warns %v, err %v", warns, err)
+	}
+	want := []cue{
+		{ms(1000), ms(2000), "First cue"},
+		{ms(3000), ms(4000), "Nested div cue"},
+	}
+	if got := cues(blocks); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q\nwant %q", got, want)
+	}
+}
+
+func TestParseSRTUnpaddedTimestamps(t *testing.T) {
+	data, err := os.ReadFile("testdata/unpadded.srt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks, warns := parseSRTString(string(data), nil)
+	if len(warns) > 0 {
+		t.Fatalf("warns %v", warns)
+	}
+	want := []cue{
+		{ms(1000), ms(2000), "Single-digit hour"},
+		{ms(3000), ms(4500), "Single-digit minute"},
+		{ms(5250), ms(6500), "Everything short"},
+		{ms(7000), ms(8000), "Dots instead of commas"},
+		{ms(3723004), ms(3724000), "Later hour"},
+	}
+	if got := cues(blocks); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v\nwant %v", got, want)
+	}
+}
+
+func TestParseSRTMalformedIndices(t *testing.T) {
+	tests := []struct {
+		file string
+		want []cue
+	}{
+		{"no_index.srt", []cue{
+			{ms(1000), ms(2000), "No index here"},
+			{ms(3000), ms(4000), "Still none\nSecond line"},
+			{ms(5000), ms(6000), "Last one"},
+		}},
+		{"index_whitespace.srt", []cue{
+			{ms(1000), ms(2000), "Trailing spaces"},
+			{ms(3000), ms(4000), "Trailing tab"},
+			{ms(5000), ms(6000), "Padded both sides"},
+		}},
+		{"single_newline.srt", []cue{
+			{ms(1000), ms(2000), "First cue"},
+			{ms(3000), ms(4000), "Second cue\nwith two lines"},
+			{ms(5000), ms(6000), "Third cue"},
+			{ms(7000), ms(8000), "No index, no gap"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			data, err := os.ReadFile("testdata/" + tt.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			blocks, warns := parseSRTString(string(data), nil)
+			if len(warns) > 0 {
+				t.Fatalf("warns %v", warns)
+			}
+			if got := cues(blocks); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v\nwant %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConversionComment(t *testing.T) {
+	tests := []struct {
+		name string
+		set  func(o *Options)
+		want string
+	}{
+		{"defaults", func(o *Options) {}, "; Dikonversi dari: srt (opsi bawaan)"},
+		{"changed flags", func(o *Options) {
+			o.Tolerance = 500 * time.Millisecond
+			o.Blur = 0
+		}, "; Dikonversi dari: srt, -blur 0 -tolerance 0.5"},
+		{"font with spaces", func(o *Options) { o.Font = "Open Sans" }, `; Dikonversi dari: srt, -font "Open Sans"`},
+		{"paths and commands left out", func(o *Options) {
+			o.OutDir = "/home/user/out"
+			o.PostCmd = "mkvmerge {{.Output}}"
+		}, "; Dikonversi dari: srt (opsi bawaan)"},
+		{"template by file name", func(o *Options) { o.TemplatePath = "/home/user/kits/Group Kit.ass" }, `; Dikonversi dari: srt, -template "Group Kit.ass"`},
+		{"style config by file name", func(o *Options) { o.StyleConfig = "/home/user/kits/styles.json" }, "; Dikonversi dari: srt, -style-config styles.json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := DefaultOptions()
+			o.sourceFormat = "srt"
+			tt.set(&o)
+			if got := conversionComment(o); got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripFontTags(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"{\\fs40}", ""},
+		{"{\\fnArial\\fs40}Hello", "Hello"},
+		{"{\\fs40\\an8}Top", "{\\an8}Top"},
+		{"{\\b1}bold{\\fs20}", "{\\b1}bold"},
+		{"no tags", "no tags"},
+	}
+	for _, tt := range tests {
+		if got := stripFontTags(tt.in); got != tt.want {
+			t.Errorf("stripFontTags(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseTextFormat(t *testing.T) {
+	data, err := os.ReadFile("testdata/translation.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := DefaultOptions()
+	opts.TextFormat = `(?m)^(?P<start>[\d:.]+) ;; (?P<end>[\d:.]*) ;; (?P<text>.+)$`
+	if err := opts.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	blocks, warns, err := parseTextFormat(data, opts)
+	if err != nil || len(warns) > 0 {
+		t.Fatalf("err %v, warns %v", err, warns)
+	}
+	want := []cue{
+		{ms(1000), ms(2500), "Good morning"},
+		{ms(3000), ms(4000), "Where are we going?"},
+		{ms(5000), ms(7000), "No end time given"},
+	}
+	if got := cues(blocks); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v\nwant %v", got, want)
+	}
+	if !blocks[2].EndGuessed || blocks[0].EndGuessed {
+		t.Errorf("EndGuessed = %v, %v, want only the last cue guessed", blocks[0].EndGuessed, blocks[2].EndGuessed)
+	}
+	out, _, err := Convert("testdata/translation.txt", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Dialogue: 0,0:00:03.00,0:00:04.00,Default,,0,0,0,,{\\blur3}{\\fad(00,40)}Where are we going?\n"; !strings.Contains(out, want) {
+		t.Errorf("Convert output lacks %q:\n%s", want, out)
+	}
+
+	for _, bad := range []string{`(?P<start>\S+) (?P<text>`, `(?P<begin>\S+) (?P<text>.*)`} {
+		opts := DefaultOptions()
+		opts.TextFormat = bad
+		if err := opts.Prepare(); err == nil {
+			t.Errorf("-text-format %q: want an error", bad)
+		}
+	}
+}
+
+func TestMergeNoMergeTanda(t *testing.T) {
+	blocks := []SRTBlock{
+		{Start: ms(1000), End: ms(3000), Text: "TOKYO, 2025", Style: "tanda"},
+		{Start: ms(4000), End: ms(6000), Text: "TOKYO, 2025", Style: "tanda"},
+		{Start: ms(6000), End: ms(7000), Text: "TOKYO, 2025", Style: "tanda"},
+		{Start: ms(10000), End: ms(11000), Text: "Hello", Style: "Default"},
+		{Start: ms(12000), End: ms(13000), Text: "Hello", Style: "Default"},
+	}
+	tests := []struct {
+		name         string
+		noMergeTanda bool
+		want         []cue
+	}{
+		{"default", false, []cue{
+			{ms(1000), ms(7000), "TOKYO, 2025"},
+			{ms(10000), ms(13000), "Hello"},
+		}},
+		{"-no-merge-tanda", true, []cue{
+			{ms(1000), ms(3000), "TOKYO, 2025"},
+			{ms(4000), ms(7000), "TOKYO, 2025"},
+			{ms(10000), ms(13000), "Hello"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := append([]SRTBlock(nil), blocks...)
+			got := cues(mergeSameOrContinuous(in, 2*time.Second, 0, tt.noMergeTanda))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v\nwant %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripSpeakers(t *testing.T) {
+	opts := DefaultOptions()
+	opts.StripSpeakers = true
+	opts.SpeakerRegex = []string{`^♪\s*`}
+	if err := opts.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct{ in, want string }{
+		{">> hello there", "hello there"},
+		{"[MUSIC] Welcome back", "Welcome back"},
+		{"(laughs) Stop it", "Stop it"},
+		{"JOHN: Over here", "Over here"},
+		{"MARY JANE: Wait", "Wait"},
+		{"DR. O'NEIL: Sit", "Sit"},
+		{"Mary Jane: Wait", "Mary Jane: Wait"},
+		{"Note: the door is open", "Note: the door is open"},
+		{">> JOHN: [laughs] hi", "hi"},
+		{"♪ la la la", "la la la"},
+		{"[MUSIC]\nNext line", "Next line"},
+		{"[APPLAUSE]", ""},
+		{"Time is 10:30 now", "Time is 10:30 now"},
+		{"no prefix: kept lowercase", "no prefix: kept lowercase"},
+	}
+	for _, tt := range tests {
+		if got := stripSpeakers(tt.in, opts.speakers); got != tt.want {
+			t.Errorf("stripSpeakers(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSRTCoordPos(t *testing.T) {
+	unscaled := newResampleScale(1920, 1080, 1920, 1080, "stretch")
+	tests := []struct {
+		coords string
+		sc     resampleScale
+		want   string
+	}{
+		{"X1:100 X2:200 Y1:300 Y2:400", unscaled, "{\\an8\\pos(150,300)}"},
+		{"X1:100 X2:200 Y1:300", unscaled, "{\\an8\\pos(150,300)}"},
+		{"X1:100 Y1:300 Y2:400", unscaled, ""},
+		{"X2:200 Y1:300 Y2:400", unscaled, ""},
+		{"X1:100 X2:200 Y2:400", unscaled, ""},
+		{"", unscaled, ""},
+		{"X1:100 X2:200 Y1:300 Y2:400", newResampleScale(640, 360, 1920, 1080, "stretch"), "{\\an8\\pos(450,900)}"},
+	}
+	for _, tt := range tests {
+		if got := srtCoordPos(tt.coords, tt.sc); got != tt.want {
+			t.Errorf("srtCoordPos(%q) = %q, want %q", tt.coords, got, tt.want)
+		}
+	}
+}
+
+func TestParseSRTCoordinates(t *testing.T) {
+	data := "1\n00:00:01,000 --> 00:00:02,500 X1:100 X2:200 Y1:300 Y2:400\nHi\n"
+	sc := newResampleScale(1920, 1080, 1920, 1080, "stretch")
+	tests := []struct {
+		name string
+		pos  *resampleScale
+		want []cue
+	}{
+		{"ignored", nil, []cue{{ms(1000), ms(2500), "Hi"}}},
+		{"as pos", &sc, []cue{{ms(1000), ms(2500), "{\\an8\\pos(150,300)}Hi"}}},
+	}
+	for _, tt := range tests {
+		blocks, warns := parseSRTString(data, tt.pos)
+		if got := cues(blocks); len(warns) > 0 || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v (warns %v), want %v", tt.name, got, warns, tt.want)
+		}
+	}
+}
+
+func TestValidateBlocks(t *testing.T) {
+	block := func(src, start, end int, style, text string) SRTBlock {
+		return SRTBlock{Start: ms(start), End: ms(end), Style: style, Text: text, Sources: []int{src}}
+	}
+	tests := []struct {
+		name   string
+		blocks []SRTBlock
+		want   []Warning
+	}{
+		{"clean", []SRTBlock{
+			block(1, 0, 1000, "Default", "a"),
+			block(2, 1000, 2000, "Default", "b"),
+		}, nil},
+		{"sign over dialogue", []SRTBlock{
+			block(1, 0, 3000, "Default", "a"),
+			block(2, 500, 2500, "tanda", "SIGN"),
+			block(3, 1000, 2000, "Default", "b"),
+		}, []Warning{{Index: 3, Msg: "tumpang tindih 2s dengan blok 1"}}},
+		{"other layer", []SRTBlock{
+			block(1, 0, 3000, "Default", "a"),
+			{Start: ms(1000), End: ms(2000), Style: "Default", Layer: 1, Text: "b", Sources: []int{2}},
+		}, nil},
+		{"exact repeat", []SRTBlock{
+			block(1, 0, 1000, "Default", "a"),
+			block(2, 0, 1000, "Default", "a"),
+		}, nil},
+		{"zero and negative", []SRTBlock{
+			block(1, 1000, 1000, "Default", "a"),
+			block(2, 3000, 2000, "Default", "b"),
+		}, []Warning{
+			{Index: 1, Msg: "durasi nol di 00:00:01,000"},
+			{Index: 2, Msg: "waktu selesai 00:00:02,000 sebelum waktu mulai 00:00:03,000"},
+		}},
+		{"reported by file position", []SRTBlock{
+			block(4, 0, 2000, "Default", "a"),
+			block(3, 1500, 2500, "Default", "b"),
+		}, []Warning{{Index: 3, Msg: "tumpang tindih 500ms dengan blok 4"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validateBlocks(tt.blocks); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v\nwant %v", got, tt.want)
+			}
+		})
+	}
+}
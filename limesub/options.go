@@ -0,0 +1,494 @@
+package limesub
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// ====================== OPTIONS ======================
+
+const defaultFont = "Basic Comical NC"
+
+// Options carries every conversion setting. The zero value converts like the
+// CLI without flags: Prepare gives every field left zero its DefaultOptions
+// value, so a literal only needs the fields it changes. To turn off a setting
+// that is on by default (Blur, FadeOut, Tolerance, the margins), start from
+// DefaultOptions and set it to 0 there; its fields are taken as given.
+type Options struct {
+	Font           string        // style font, "" = Basic Comical NC
+	Format         string        // output format: ass, srt or vtt
+	InputFormat    string        // parser to use instead of the file extension
+	TextFormat     string        // regex with start/end/text groups, replaces the parser
+	SortBy         string        // start, end or layer
+	SameTime       string        // join, keep or layer for same-style cues with equal timing
+	JSONTimeUnit   string        // ms, s or auto
+	JSONDefaultDur time.Duration // JSON cue length when none is given, 0 = 2s
+	CollapseSpaces bool
+	Blur           float64 // \blur on dialogue lines, 0 = none
+	FadeIn         int     // \fad in, ms
+	FadeOut        int     // \fad out, ms
+	AdaptiveFade   float64 // fade as % of each cue's duration, 0 = use FadeIn/FadeOut
+	FadeMin        int     // lower bound for AdaptiveFade, ms
+	FadeMax        int     // upper bound for AdaptiveFade, ms
+	Annotate       bool
+	TandaCase      string // upper, lower or none for tanda text
+
+	MarginL, MarginR, MarginV                int
+	TandaMarginL, TandaMarginR, TandaMarginV int
+
+	KaraokeSecondary string // SecondaryColour of the Default style, "" = white
+
+	AlsoSRT        bool
+	MaxCueDur      time.Duration // 0 = no cap
+	MaxMergeDur    time.Duration // 0 = no cap
+	NoMergeTanda   bool          // tanda repeats only merge when they touch
+	MinDur         time.Duration // after merging, lengthen shorter cues; 0 = off
+	MaxDur         time.Duration // after merging, cap longer cues; 0 = off
+	Tolerance      time.Duration // max gap between repeats to merge, 0 = off
+	Audit          bool
+	DedupFile      bool   // drop cues repeating an earlier one exactly
+	DryValidate    bool   // only check that every input parses
+	Recursive      bool   // also look in subfolders of folder arguments
+	Jobs           int    // files converted at the same time
+	Charset        string // input codepage, "" = UTF-8 (Windows-1252 fallback)
+	OutputEncoding string // "" = UTF-8
+	OutDir         string // "" = next to the input
+	TTMLSpans      bool
+	TemplatePath   string
+	StyleConfig    string // JSON file with the styles and their effect tags
+	Strict         bool
+	SourceRes      string          // WxH override for the resample source
+	ResX, ResY     int             // resample target resolution, 0 = 1920x1080
+	KeepFonts      bool            // resample without replacing font names
+	ResampleMode   string          // stretch or letterbox
+	ValidateUTF8   bool            // reject input that isn't valid UTF-8
+	TwoPassMerge   bool            // repeat both merge steps until nothing changes
+	MinCueInterval time.Duration   // 0 = keep every cue
+	KeepEmptyLines bool            // keep blank lines inside cues
+	DropRepeats    bool            // drop a line that repeats the one above it
+	StripTags      bool            // drop ASS override tags found in the input text
+	NormalizeNFC   bool            // compose text to Unicode NFC
+	CollapseTanda  bool            // join tanda lines with a space instead of \N
+	StripSpeakers  bool            // drop >>, [sound] and NAME: line prefixes
+	SpeakerRegex   []string        // extra prefixes for StripSpeakers
+	SRTPos         bool            // turn SRT X1/X2/Y1/Y2 coordinates into \pos
+	SplitAt        []time.Duration // write one part per range between these times
+	Rebase         bool            // start every split part at 0:00
+	MaxCPS         float64         // reading speed limit, 0 = don't check
+	CPSFix         bool            // lengthen cues above MaxCPS
+	FixOverlap     bool            // shorten cues that run into the next one
+	OverlapGap     time.Duration   // space left by FixOverlap
+	Sample         int             // keep only the first N cues, 0 = all
+	RateScale      float64         // multiplies every timing before Shift, 0 = off
+	FromFPS, ToFPS float64         // RateScale as FromFPS/ToFPS when both are set
+	Shift          time.Duration   // added to every timing, results below 0 become 0
+	PostCmd        string          // shell command run on each output, {{.Output}} = its path (via $LIMESUB_OUTPUT)
+
+	Log io.Writer // progress and warning messages, nil = discarded
+
+	template     *assTemplate
+	postCmd      *template.Template
+	textFormat   *regexp.Regexp
+	speakers     []*regexp.Regexp
+	sourceFormat string // input format, for the ASS header comment
+	defaulted    bool   // zero fields mean 0, not "use the default"
+}
+
+// DefaultOptions returns the settings used when no flag is given.
+func DefaultOptions() Options {
+	return Options{
+		Font:           defaultFont,
+		Format:         "ass",
+		SortBy:         "start",
+		SameTime:       "join",
+		Tolerance:      200 * time.Millisecond,
+		OverlapGap:     time.Millisecond,
+		JSONTimeUnit:   "auto",
+		JSONDefaultDur: 2 * time.Second,
+		Blur:           3,
+		FadeOut:        40,
+		FadeMin:        10,
+		FadeMax:        200,
+		MarginL:        64,
+		MarginR:        64,
+		MarginV:        33,
+		OutputEncoding: "utf-8",
+		ResX:           resampleTargetX,
+		ResY:           resampleTargetY,
+		ResampleMode:   "stretch",
+		Jobs:           1,
+		TandaCase:      "none",
+		defaulted:      true,
+	}
+}
+
+// fillDefaults sets every field left at zero to its DefaultOptions value.
+// ResX/ResY are left to Prepare, which resets both when either is unset.
+func (o *Options) fillDefaults() {
+	d := DefaultOptions()
+	orDefault(&o.Font, d.Font)
+	orDefault(&o.Format, d.Format)
+	orDefault(&o.SortBy, d.SortBy)
+	orDefault(&o.SameTime, d.SameTime)
+	orDefault(&o.Tolerance, d.Tolerance)
+	orDefault(&o.OverlapGap, d.OverlapGap)
+	orDefault(&o.JSONTimeUnit, d.JSONTimeUnit)
+	orDefault(&o.JSONDefaultDur, d.JSONDefaultDur)
+	orDefault(&o.Blur, d.Blur)
+	orDefault(&o.FadeOut, d.FadeOut)
+	orDefault(&o.FadeMin, d.FadeMin)
+	orDefault(&o.FadeMax, d.FadeMax)
+	orDefault(&o.MarginL, d.MarginL)
+	orDefault(&o.MarginR, d.MarginR)
+	orDefault(&o.MarginV, d.MarginV)
+	orDefault(&o.OutputEncoding, d.OutputEncoding)
+	orDefault(&o.ResampleMode, d.ResampleMode)
+	orDefault(&o.Jobs, d.Jobs)
+	orDefault(&o.TandaCase, d.TandaCase)
+	o.defaulted = true
+}
+
+func orDefault[T comparable](v *T, def T) {
+	var zero T
+	if *v == zero {
+		*v = def
+	}
+}
+
+func (o Options) logf(format string, args ...interface{}) {
+	if o.Log != nil {
+		fmt.Fprintf(o.Log, format, args...)
+	}
+}
+
+func (o Options) logln(args ...interface{}) {
+	if o.Log != nil {
+		fmt.Fprintln(o.Log, args...)
+	}
+}
+
+func (o Options) font() string {
+	if o.Font == "" {
+		return defaultFont
+	}
+	return o.Font
+}
+
+// BindFlags registers the CLI flags onto o, using its current values as defaults.
+func BindFlags(fs *flag.FlagSet, o *Options) {
+	fs.StringVar(&o.Format, "format", o.Format, "format output: ass, srt, atau vtt")
+	fs.StringVar(&o.InputFormat, "informat", o.InputFormat, "format input (srt, vtt, json, ...) jika tidak bisa ditebak dari ekstensi, wajib untuk input -")
+	fs.StringVar(&o.TextFormat, "text-format", o.TextFormat, "baca input dengan regex ber-grup start, end, dan text, mis. \"(?m)^(?P<start>\\S+)\\t(?P<end>\\S+)\\t(?P<text>.*)$\"")
+	fs.StringVar(&o.SortBy, "sort-by", o.SortBy, "urutan event output: start, end, atau layer")
+	fs.StringVar(&o.SameTime, "same-time-behavior", o.SameTime, "cue dengan style dan waktu yang sama: join (satu baris \\N), keep (biarkan terpisah), atau layer (pisah di layer berbeda)")
+	fs.StringVar(&o.Font, "font", o.Font, "font untuk style Default dan tanda")
+	fs.StringVar(&o.KaraokeSecondary, "karaoke-secondary", o.KaraokeSecondary, "warna \\k yang belum dinyanyikan (SecondaryColour style Default), mis. #FF8000")
+	fs.StringVar(&o.JSONTimeUnit, "json-time-unit", o.JSONTimeUnit, "satuan waktu numerik di JSON: ms, s, atau auto")
+	fs.Var((*secondsFlag)(&o.JSONDefaultDur), "json-default-dur", "durasi maksimal (detik) cue JSON tanpa durasi; cue berakhir saat cue berikutnya mulai")
+	fs.Float64Var(&o.Blur, "blur", o.Blur, "nilai \\blur untuk baris dialog (0 = tanpa blur)")
+	fs.IntVar(&o.FadeIn, "fade-in", o.FadeIn, "durasi fade in (ms) pada baris dialog")
+	fs.IntVar(&o.FadeOut, "fade-out", o.FadeOut, "durasi fade out (ms) pada baris dialog")
+	fs.Float64Var(&o.AdaptiveFade, "adaptive-fade", o.AdaptiveFade, "fade in/out sebesar N% dari durasi tiap cue, dibatasi -fade-min dan -fade-max (0 = pakai -fade-in/-fade-out)")
+	fs.IntVar(&o.FadeMin, "fade-min", o.FadeMin, "batas bawah fade (ms) untuk -adaptive-fade")
+	fs.IntVar(&o.FadeMax, "fade-max", o.FadeMax, "batas atas fade (ms) untuk -adaptive-fade")
+	fs.BoolVar(&o.CollapseSpaces, "collapse-spaces", o.CollapseSpaces, "rapatkan spasi ganda pada teks dialog (di luar tag)")
+	fs.StringVar(&o.TandaCase, "tanda-case", o.TandaCase, "ubah huruf teks style tanda di output ASS: upper, lower, atau none")
+	fs.BoolVar(&o.Annotate, "annotate", o.Annotate, "tambahkan baris Comment berisi indeks blok sumber sebelum tiap Dialogue")
+	fs.IntVar(&o.MarginL, "margin-l", o.MarginL, "MarginL style Default")
+	fs.IntVar(&o.MarginR, "margin-r", o.MarginR, "MarginR style Default")
+	fs.IntVar(&o.MarginV, "margin-v", o.MarginV, "MarginV style Default")
+	fs.IntVar(&o.TandaMarginL, "tanda-margin-l", o.TandaMarginL, "MarginL style tanda")
+	fs.IntVar(&o.TandaMarginR, "tanda-margin-r", o.TandaMarginR, "MarginR style tanda")
+	fs.IntVar(&o.TandaMarginV, "tanda-margin-v", o.TandaMarginV, "MarginV style tanda")
+	fs.BoolVar(&o.AlsoSRT, "also-srt", o.AlsoSRT, "tulis juga file .srt bersih di samping .ass")
+	fs.Var((*secondsFlag)(&o.MaxCueDur), "max-cue-dur", "potong durasi cue yang lebih dari N detik (0 = nonaktif)")
+	fs.Var((*secondsFlag)(&o.Tolerance), "tolerance", "jeda maksimum (detik) antara cue bertek sama yang digabung; 0 = jangan gabungkan cue bersambung")
+	fs.BoolVar(&o.NoMergeTanda, "no-merge-tanda", o.NoMergeTanda, "jangan gabungkan tanda yang berulang jika ada jeda di antaranya (mis. tanda lokasi setelah pergantian adegan)")
+	fs.Var((*secondsFlag)(&o.MaxMergeDur), "max-merge-dur", "batas durasi (detik) hasil penggabungan cue berulang (0 = tanpa batas)")
+	fs.Var((*secondsFlag)(&o.MinDur), "min-dur", "setelah merge, perpanjang cue yang tampil kurang dari N detik (tanpa menabrak cue berikutnya)")
+	fs.Var((*secondsFlag)(&o.MaxDur), "max-dur", "setelah merge, potong cue yang tampil lebih dari N detik")
+	fs.BoolVar(&o.Audit, "audit", o.Audit, "periksa file dan laporkan masalah tanpa menulis output")
+	fs.BoolVar(&o.DedupFile, "dedup-file", o.DedupFile, "buang cue yang persis sama (waktu dan teks) dengan cue sebelumnya, mis. file yang isinya tergandakan")
+	fs.StringVar(&o.Charset, "charset", o.Charset, "encoding file input jika bukan UTF-8, mis. windows-1252, iso-8859-1, shift_jis")
+	fs.IntVar(&o.Jobs, "jobs", o.Jobs, "jumlah file yang dikonversi bersamaan")
+	fs.BoolVar(&o.Recursive, "recursive", o.Recursive, "jika argumen berupa folder, ikut proses subtitle di subfolder-nya")
+	fs.BoolVar(&o.DryValidate, "dry-validate", o.DryValidate, "hanya periksa apakah tiap file bisa dibaca; keluar dengan kode 1 jika ada yang gagal")
+	fs.StringVar(&o.OutDir, "outdir", o.OutDir, "folder tujuan output (dibuat jika belum ada); kosong = di samping file input")
+	fs.StringVar(&o.OutputEncoding, "output-encoding", o.OutputEncoding, "encoding file output, mis. shift_jis atau gbk")
+	fs.BoolVar(&o.TTMLSpans, "ttml-spans", o.TTMLSpans, "pecah <p> TTML menjadi cue per <span> yang punya begin/end sendiri")
+	fs.StringVar(&o.TemplatePath, "template", o.TemplatePath, "file .ass yang header dan style-nya dipakai untuk input non-ASS")
+	fs.StringVar(&o.StyleConfig, "style-config", o.StyleConfig, "file JSON berisi style ASS dan tag efek per style, pengganti style bawaan Limenime")
+	fs.BoolVar(&o.Strict, "strict", o.Strict, "gagalkan konversi jika ada peringatan saat parsing")
+	fs.BoolVar(&o.ValidateUTF8, "force-utf8-validation", o.ValidateUTF8, "tolak input yang bukan UTF-8 valid alih-alih menghasilkan teks rusak")
+	fs.BoolVar(&o.TwoPassMerge, "two-pass-merge", o.TwoPassMerge, "ulangi kedua tahap merge sampai jumlah cue tidak berubah")
+	fs.Var((*secondsFlag)(&o.MinCueInterval), "min-cue-interval", "gabungkan teks cue yang mulai kurang dari N detik setelah cue sebelumnya (untuk caption ASR)")
+	fs.BoolVar(&o.SRTPos, "srt-pos", o.SRTPos, "ubah koordinat X1/X2/Y1/Y2 di baris waktu SRT menjadi \\pos (diskalakan dari -source-res, tanpa itu dianggap 1920x1080)")
+	fs.BoolVar(&o.NormalizeNFC, "normalize-unicode", o.NormalizeNFC, "satukan huruf dan tanda diakritik yang terpisah (NFC), mis. e + aksen menjadi é")
+	fs.BoolVar(&o.CollapseTanda, "collapse-tanda-newlines", o.CollapseTanda, "gabungkan baris-baris cue tanda dengan spasi, bukan \\N")
+	fs.BoolVar(&o.StripSpeakers, "strip-speakers", o.StripSpeakers, "buang awalan >>, tag suara [MUSIC], dan label huruf kapital \"NAMA:\" di awal baris")
+	fs.Var((*stringListFlag)(&o.SpeakerRegex), "speaker-pattern", "regex tambahan untuk -strip-speakers (boleh diulang), mis. \"^- \"")
+	fs.BoolVar(&o.StripTags, "strip-tags", o.StripTags, "buang tag ASS {\\...} yang sudah ada di teks input (mis. {\\an8} di SRT)")
+	fs.BoolVar(&o.KeepEmptyLines, "keep-empty-lines", o.KeepEmptyLines, "pertahankan baris kosong di dalam cue (mis. ASCII art) sebagai \\N")
+	fs.BoolVar(&o.DropRepeats, "drop-repeated-lines", o.DropRepeats, "buang baris yang sama dengan baris di atasnya dalam satu cue (untuk caption otomatis)")
+	fs.Var((*timeListFlag)(&o.SplitAt), "split-at", "pecah output menjadi beberapa file pada waktu ini, mis. 0:21:30,0:43:00")
+	fs.BoolVar(&o.Rebase, "rebase", o.Rebase, "dengan -split-at, mulai waktu tiap bagian dari 0")
+	fs.Float64Var(&o.MaxCPS, "max-cps", o.MaxCPS, "laporkan cue yang lebih cepat dari N karakter per detik (0 = nonaktif)")
+	fs.BoolVar(&o.CPSFix, "cps-fix", o.CPSFix, "perpanjang cue yang melebihi -max-cps tanpa menabrak cue berikutnya")
+	fs.BoolVar(&o.FixOverlap, "fix-overlap", o.FixOverlap, "potong akhir cue yang menabrak cue berikutnya (style sama), mis. untuk subtitle hasil OCR")
+	fs.Var((*secondsFlag)(&o.OverlapGap), "overlap-gap", "jarak antar cue yang disisakan -fix-overlap, dalam detik")
+	fs.Float64Var(&o.RateScale, "rate-scale", o.RateScale, "kalikan semua timing dengan N sebelum -shift, mis. 1.0427 untuk 25 ke 23.976 fps")
+	fs.Float64Var(&o.FromFPS, "from-fps", o.FromFPS, "frame rate video asal subtitle; bersama -to-fps menggantikan -rate-scale")
+	fs.Float64Var(&o.ToFPS, "to-fps", o.ToFPS, "frame rate video tujuan; bersama -from-fps menggantikan -rate-scale")
+	fs.Var((*shiftFlag)(&o.Shift), "shift", "geser semua timing, mis. +2.5s atau -800ms (hasil negatif menjadi 0)")
+	fs.StringVar(&o.PostCmd, "post-cmd", o.PostCmd, "perintah shell yang dijalankan setelah tiap output ditulis, mis. \"mkvmerge -o out.mkv video.mkv \\\"{{.Output}}\\\"\"; {{.Output}} diisi lewat variabel LIMESUB_OUTPUT sehingga nama file tidak pernah dijalankan sebagai perintah")
+	fs.IntVar(&o.Sample, "sample", o.Sample, "tulis hanya N cue pertama (setelah merge) untuk mencoba style dengan cepat; 0 = semua")
+	fs.StringVar(&o.SourceRes, "source-res", o.SourceRes, "resolusi sumber ASS (WxH) untuk resample, menggantikan PlayResX/Y di header")
+	fs.StringVar(&o.ResampleMode, "resample-mode", o.ResampleMode, "saat rasio aspek berubah: stretch (skala per sumbu) atau letterbox (skala seragam, posisi tetap di tengah)")
+	fs.BoolVar(&o.KeepFonts, "keep-fonts", o.KeepFonts, "saat resample ASS, pertahankan font asli (Style dan \\fn) alih-alih Basic Comical NC")
+	fs.IntVar(&o.ResX, "resx", o.ResX, "lebar tujuan (PlayResX) saat resample ASS")
+	fs.IntVar(&o.ResY, "resy", o.ResY, "tinggi tujuan (PlayResY) saat resample ASS")
+}
+
+// Prepare fills in defaults (see Options), validates the options and loads
+// the -template or -style-config file, if any. Convert and ProcessFile call
+// it themselves; calling it again on prepared options is cheap.
+func (o *Options) Prepare() error {
+	if !o.defaulted {
+		o.fillDefaults()
+	}
+	switch o.JSONTimeUnit {
+	case "", "ms", "s", "auto":
+	default:
+		return fmt.Errorf("nilai -json-time-unit tidak dikenal: %q (gunakan ms, s, atau auto)", o.JSONTimeUnit)
+	}
+	switch o.Format {
+	case "", "ass", "srt", "vtt":
+	default:
+		return fmt.Errorf("nilai -format tidak dikenal: %q (gunakan ass, srt, atau vtt)", o.Format)
+	}
+	if o.InputFormat != "" {
+		if f := detectFormat("." + strings.TrimPrefix(o.InputFormat, ".")); f == "unknown" {
+			return fmt.Errorf("nilai -informat tidak dikenal: %q (gunakan %s, atau ASS)", o.InputFormat, supportedFormats())
+		}
+	}
+	switch o.SortBy {
+	case "", "start", "end", "layer":
+	default:
+		return fmt.Errorf("nilai -sort-by tidak dikenal: %q (gunakan start, end, atau layer)", o.SortBy)
+	}
+	if o.KaraokeSecondary != "" {
+		c, err := parseASSColor(o.KaraokeSecondary)
+		if err != nil {
+			return fmt.Errorf("nilai -karaoke-secondary: %w", err)
+		}
+		o.KaraokeSecondary = c
+	}
+	switch o.TandaCase {
+	case "", "none", "upper", "lower":
+	default:
+		return fmt.Errorf("nilai -tanda-case tidak dikenal: %q (gunakan upper, lower, atau none)", o.TandaCase)
+	}
+	switch o.SameTime {
+	case "", "join", "keep", "layer":
+	default:
+		return fmt.Errorf("nilai -same-time-behavior tidak dikenal: %q (gunakan join, keep, atau layer)", o.SameTime)
+	}
+	switch o.ResampleMode {
+	case "", "stretch", "letterbox":
+	default:
+		return fmt.Errorf("nilai -resample-mode tidak dikenal: %q (gunakan stretch atau letterbox)", o.ResampleMode)
+	}
+	if o.ResX < 0 || o.ResY < 0 {
+		return fmt.Errorf("nilai -resx/-resy tidak boleh negatif")
+	}
+	if o.ResX == 0 || o.ResY == 0 {
+		// as in resampleASS, an unset resolution means 1920x1080
+		o.ResX, o.ResY = resampleTargetX, resampleTargetY
+	}
+	if o.CPSFix && o.MaxCPS <= 0 {
+		return fmt.Errorf("-cps-fix butuh -max-cps, mis. -max-cps 17")
+	}
+	if o.MinDur < 0 || o.MaxDur < 0 {
+		return fmt.Errorf("nilai -min-dur dan -max-dur tidak boleh negatif")
+	}
+	if o.MinDur > 0 && o.MaxDur > 0 && o.MinDur > o.MaxDur {
+		return fmt.Errorf("-min-dur tidak boleh lebih besar dari -max-dur")
+	}
+	if o.OverlapGap < 0 {
+		return fmt.Errorf("nilai -overlap-gap tidak boleh negatif")
+	}
+	if o.RateScale < 0 || o.FromFPS < 0 || o.ToFPS < 0 {
+		return fmt.Errorf("nilai -rate-scale, -from-fps, dan -to-fps tidak boleh negatif")
+	}
+	if (o.FromFPS > 0) != (o.ToFPS > 0) {
+		return fmt.Errorf("-from-fps dan -to-fps harus dipakai bersama")
+	}
+	if o.FromFPS > 0 && o.RateScale > 0 {
+		return fmt.Errorf("pilih salah satu: -rate-scale atau -from-fps/-to-fps")
+	}
+	if o.JSONDefaultDur < 0 {
+		return fmt.Errorf("nilai -json-default-dur tidak boleh negatif")
+	}
+	if o.Jobs < 0 {
+		return fmt.Errorf("nilai -jobs tidak boleh negatif")
+	}
+	if o.Sample < 0 {
+		return fmt.Errorf("nilai -sample tidak boleh negatif")
+	}
+	if o.Tolerance < 0 {
+		return fmt.Errorf("nilai -tolerance tidak boleh negatif")
+	}
+	if o.AdaptiveFade < 0 || o.FadeMin < 0 || o.FadeMax < o.FadeMin {
+		return fmt.Errorf("nilai -adaptive-fade, -fade-min, dan -fade-max tidak valid (tidak boleh negatif, -fade-max >= -fade-min)")
+	}
+	if o.Blur < 0 || o.FadeIn < 0 || o.FadeOut < 0 {
+		return fmt.Errorf("nilai -blur, -fade-in, dan -fade-out tidak boleh negatif")
+	}
+	for _, m := range []int{o.MarginL, o.MarginR, o.MarginV, o.TandaMarginL, o.TandaMarginR, o.TandaMarginV} {
+		if m < 0 {
+			return fmt.Errorf("nilai margin tidak boleh negatif")
+		}
+	}
+	if o.OutDir != "" {
+		if err := os.MkdirAll(o.OutDir, 0o755); err != nil {
+			return fmt.Errorf("gagal membuat folder output: %w", err)
+		}
+	}
+	if o.TextFormat != "" && o.textFormat == nil {
+		re, err := regexp.Compile(o.TextFormat)
+		if err != nil {
+			return fmt.Errorf("nilai -text-format tidak valid: %w", err)
+		}
+		if re.SubexpIndex("start") < 0 || re.SubexpIndex("text") < 0 {
+			return fmt.Errorf("-text-format butuh grup (?P<start>...) dan (?P<text>...)")
+		}
+		o.textFormat = re
+	}
+	if o.StripSpeakers && o.speakers == nil {
+		for _, p := range append(append([]string(nil), defaultSpeakerPatterns...), o.SpeakerRegex...) {
+			re, err := regexp.Compile(p)
+			if err != nil {
+				return fmt.Errorf("nilai -speaker-pattern tidak valid: %w", err)
+			}
+			o.speakers = append(o.speakers, re)
+		}
+	}
+	if o.PostCmd != "" && o.postCmd == nil {
+		t, err := template.New("post-cmd").Option("missingkey=error").Parse(o.PostCmd)
+		if err != nil {
+			return fmt.Errorf("nilai -post-cmd tidak valid: %w", err)
+		}
+		o.postCmd = t
+	}
+	if o.TemplatePath != "" && o.StyleConfig != "" {
+		return fmt.Errorf("pilih salah satu: -template atau -style-config")
+	}
+	if o.StyleConfig != "" && o.template == nil {
+		t, err := loadStyleConfig(o.StyleConfig)
+		if err != nil {
+			return fmt.Errorf("gagal membaca -style-config: %w", err)
+		}
+		o.template = t
+	}
+	if o.TemplatePath != "" && o.template == nil {
+		t, err := loadTemplate(o.TemplatePath)
+		if err != nil {
+			return fmt.Errorf("gagal membaca template: %w", err)
+		}
+		o.template = t
+	}
+	return nil
+}
+
+// timeScale returns the factor for rescaleTimings: -rate-scale, or the
+// -from-fps/-to-fps ratio; 1 when neither is set.
+func (o Options) timeScale() float64 {
+	switch {
+	case o.FromFPS > 0 && o.ToFPS > 0:
+		return o.FromFPS / o.ToFPS
+	case o.RateScale > 0:
+		return o.RateScale
+	}
+	return 1
+}
+
+// secondsFlag reads a duration flag given in (fractional) seconds.
+type secondsFlag time.Duration
+
+func (s *secondsFlag) String() string {
+	return strconv.FormatFloat(time.Duration(*s).Seconds(), 'f', -1, 64)
+}
+
+func (s *secondsFlag) Set(v string) error {
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return err
+	}
+	*s = secondsFlag(f * float64(time.Second))
+	return nil
+}
+
+// timeListFlag reads a comma separated list of timestamps (any form
+// parseTime accepts, e.g. 0:21:30 or 1290s).
+type timeListFlag []time.Duration
+
+func (l *timeListFlag) String() string {
+	var parts []string
+	for _, t := range *l {
+		parts = append(parts, formatTimeSRT(t))
+	}
+	return strings.Join(parts, ",")
+}
+
+func (l *timeListFlag) Set(v string) error {
+	*l = nil
+	for _, p := range strings.Split(v, ",") {
+		if strings.TrimSpace(p) == "" {
+			continue
+		}
+		t, err := parseTime(p)
+		if err != nil {
+			return err
+		}
+		*l = append(*l, t)
+	}
+	return nil
+}
+
+// shiftFlag reads a signed offset such as +2.5s, -800ms or -0:00:01.5.
+type shiftFlag time.Duration
+
+func (s *shiftFlag) String() string {
+	return time.Duration(*s).String()
+}
+
+func (s *shiftFlag) Set(v string) error {
+	v = strings.TrimSpace(v)
+	sign := time.Duration(1)
+	if strings.HasPrefix(v, "-") {
+		sign = -1
+	}
+	t, err := parseTime(strings.TrimLeft(v, "+-"))
+	if err != nil {
+		return err
+	}
+	*s = shiftFlag(sign * t)
+	return nil
+}
+
+// stringListFlag collects every use of a repeatable flag.
+type stringListFlag []string
+
+func (l *stringListFlag) String() string { return strings.Join(*l, " ") }
+
+func (l *stringListFlag) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
@@ -0,0 +1,170 @@
+package limesub
+
+import (
+	"flag"
+	"strings"
+	"testing"
+)
+
+func TestKaraokeSecondary(t *testing.T) {
+	tests := []struct {
+		flag, want string
+		wantErr    bool
+	}{
+		{"", "&H00FFFFFF", false},
+		{"#FF8000", "&H000080FF", false},
+		{"&H0000FFFF", "&H0000FFFF", false},
+		{"&h80ff00", "&H0080FF00", false},
+		{"orange", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.flag, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.KaraokeSecondary = tt.flag
+			if err := opts.Prepare(); (err != nil) != tt.wantErr {
+				t.Fatalf("Prepare() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			fields := strings.Split(assStyles(opts)[0], ",")
+			if primary, secondary := fields[3], fields[4]; secondary != tt.want {
+				t.Errorf("SecondaryColour = %s, want %s", secondary, tt.want)
+			} else if tt.flag != "" && secondary == primary {
+				t.Error("karaoke secondary colour should differ from the primary")
+			}
+		})
+	}
+}
+
+func TestMarginFlags(t *testing.T) {
+	opts := DefaultOptions()
+	fs := flag.NewFlagSet("limesub", flag.ContinueOnError)
+	BindFlags(fs, &opts)
+	args := []string{"-margin-l", "10", "-margin-r", "20", "-margin-v", "30", "-tanda-margin-l", "5", "-tanda-margin-v", "40"}
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	out, _, err := Convert("testdata/basic.srt", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"Style: Default,Basic Comical NC,70,&H00FFFFFF,&H00FFFFFF,&H00000000,&H80000000,0,0,0,0,100,100,0,0,1,1.5,1,2,10,20,30,1\n",
+		"Style: tanda,Basic Comical NC,75,&H00FFFFFF,&H000000FF,&H00000000,&H00000000,-1,0,0,0,100,100,0,0,1,1,0,8,5,0,40,1\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+
+	opts.MarginV = -1
+	if err := opts.Prepare(); err == nil {
+		t.Error("want an error for a negative margin")
+	}
+}
+
+func TestResampleStyleMargins(t *testing.T) {
+	in := "[Script Info]\nPlayResX: 1280\nPlayResY: 720\n\n[V4+ Styles]\n" +
+		"Format: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, OutlineColour, BackColour, Bold, Italic, Underline, StrikeOut, ScaleX, ScaleY, Spacing, Angle, BorderStyle, Outline, Shadow, Alignment, MarginL, MarginR, MarginV, Encoding\n" +
+		"Style: Default,Arial,48,&H00FFFFFF,&H000000FF,&H00000000,&H00000000,0,0,0,0,100,100,0,0,1,2,0,2,10,20,30,1\n"
+	out, err := resampleASS(in, 1920, 1080, Options{KeepFonts: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := ",2,15,30,45,1\n"; !strings.Contains(out, want) {
+		t.Errorf("margins not scaled by 1.5, want %q in:\n%s", want, out)
+	}
+}
+
+func TestPrepareResolution(t *testing.T) {
+	tests := []struct {
+		name       string
+		resX, resY int
+		wantX      int
+		wantY      int
+		wantErr    bool
+	}{
+		{"unset", 0, 0, 1920, 1080, false},
+		{"one axis unset", 1280, 0, 1920, 1080, false},
+		{"custom", 1280, 720, 1280, 720, false},
+		{"negative", -1, 720, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := Options{ResX: tt.resX, ResY: tt.resY}
+			err := o.Prepare()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Prepare() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (o.ResX != tt.wantX || o.ResY != tt.wantY) {
+				t.Errorf("resolution = %dx%d, want %dx%d", o.ResX, o.ResY, tt.wantX, tt.wantY)
+			}
+		})
+	}
+}
+
+func TestResampleASSTargetResolution(t *testing.T) {
+	in := "[Script Info]\nPlayResX: 640\nPlayResY: 360\n\n[Events]\nFormat: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text\nDialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,{\\pos(320,180)}hi\n"
+	out, err := resampleASS(in, 1280, 720, Options{KeepFonts: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"PlayResX: 1280", "PlayResY: 720", "from 640x360 to 1280x720", "{\\pos(640,360)}hi"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestConvertWithOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		opts func() Options
+		want []string
+	}{
+		{"defaults", DefaultOptions, []string{
+			"Style: Default,Basic Comical NC,70,&H00FFFFFF,&H00FFFFFF,&H00000000,&H80000000,0,0,0,0,100,100,0,0,1,1.5,1,2,64,64,33,1",
+			"Dialogue: 0,0:00:01.00,0:00:03.00,Default,,0,0,0,,{\\blur3}{\\fad(00,40)}Hello there.",
+			"Dialogue: 0,0:00:04.00,0:00:05.00,tanda,,0,0,0,,TOKYO STATION",
+		}},
+		{"zero value", func() Options { return Options{} }, []string{
+			"Style: Default,Basic Comical NC,70,&H00FFFFFF,&H00FFFFFF,&H00000000,&H80000000,0,0,0,0,100,100,0,0,1,1.5,1,2,64,64,33,1",
+			"Dialogue: 0,0:00:01.00,0:00:03.00,Default,,0,0,0,,{\\blur3}{\\fad(00,40)}Hello there.",
+			"Dialogue: 0,0:00:04.00,0:00:05.00,tanda,,0,0,0,,TOKYO STATION",
+		}},
+		{"literal with one field", func() Options { return Options{MarginV: 50} }, []string{
+			"Style: Default,Basic Comical NC,70,&H00FFFFFF,&H00FFFFFF,&H00000000,&H80000000,0,0,0,0,100,100,0,0,1,1.5,1,2,64,64,50,1",
+			"Dialogue: 0,0:00:01.00,0:00:03.00,Default,,0,0,0,,{\\blur3}{\\fad(00,40)}Hello there.",
+		}},
+		{"default turned off", func() Options {
+			o := DefaultOptions()
+			o.Blur = 0
+			return o
+		}, []string{
+			"Dialogue: 0,0:00:01.00,0:00:03.00,Default,,0,0,0,,{\\fad(00,40)}Hello there.",
+		}},
+		{"srt output", func() Options {
+			o := DefaultOptions()
+			o.Format = "srt"
+			o.Tolerance = 0
+			return o
+		}, []string{
+			"1\n00:00:01,000 --> 00:00:02,000\nHello there.\n",
+			"2\n00:00:02,100 --> 00:00:03,000\nHello there.\n",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, warns, err := Convert("testdata/basic.srt", tt.opts())
+			if err != nil || len(warns) > 0 {
+				t.Fatalf("Convert: warns %v, err %v", warns, err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(out, want) {
+					t.Errorf("output lacks %q:\n%s", want, out)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,520 @@
+package limesub
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// ====================== PIPELINE ======================
+
+// StdioPath as the input reads the subtitle from stdin and writes the result
+// to stdout; -informat then names the input format.
+const StdioPath = "-"
+
+// ExpandInputs expands wildcard arguments (*.srt) with filepath.Glob, since
+// the Windows shell passes them through literally, and replaces a folder by
+// the subtitle files in it (also in its subfolders with recursive). An
+// argument naming an existing file is kept as given even when it contains
+// glob characters, as release names like "[Group] Show - 01.srt" do. Patterns
+// that match nothing are returned in unmatched.
+func ExpandInputs(args []string, recursive bool) (inputs, unmatched []string) {
+	for _, a := range args {
+		fi, err := os.Stat(a)
+		if err == nil && fi.IsDir() {
+			inputs = append(inputs, subtitleFiles(a, recursive)...)
+			continue
+		}
+		if err == nil || a == StdioPath || !strings.ContainsAny(a, "*?[") {
+			inputs = append(inputs, a)
+			continue
+		}
+		matches, err := filepath.Glob(a)
+		if err != nil || len(matches) == 0 {
+			unmatched = append(unmatched, a)
+			continue
+		}
+		inputs = append(inputs, matches...)
+	}
+	return inputs, unmatched
+}
+
+// reOwnOutput matches names this tool writes (name_Limenime(2).ass), so
+// converting a folder twice doesn't pick up the previous results.
+var reOwnOutput = regexp.MustCompile(`_Limenime(\(\d+\))?(_part\d+)?$`)
+
+// subtitleFiles lists the files in dir with a supported extension, in
+// lexical order.
+func subtitleFiles(dir string, recursive bool) []string {
+	var files []string
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if path != dir && !recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		name := strings.TrimSuffix(d.Name(), filepath.Ext(d.Name()))
+		if detectFormat(path) != "unknown" && !reOwnOutput.MatchString(name) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files
+}
+
+// inputFormat picks the parser for inputPath: "text" with -text-format,
+// else -informat, else the extension.
+func inputFormat(inputPath string, opts Options) string {
+	switch {
+	case opts.TextFormat != "":
+		return "text"
+	case opts.InputFormat != "":
+		return strings.TrimPrefix(strings.ToLower(opts.InputFormat), ".")
+	}
+	return detectFormat(inputPath)
+}
+
+// ValidateFile only parses inputPath (stdin for StdioPath) and returns its
+// format and how many blocks (Dialogue lines for ASS) it holds. Nothing is
+// merged or written.
+func ValidateFile(inputPath string, opts Options) (string, int, error) {
+	format, raw, err := readInput(inputPath, opts)
+	if err != nil {
+		return inputFormat(inputPath, opts), 0, err
+	}
+	text, err := decodeText(raw, opts)
+	if err != nil {
+		return format, 0, err
+	}
+	n := 0
+	if format == "ass" {
+		_, sections := splitASSSections(strings.ReplaceAll(text, "\r", ""))
+		if ev := findSection(sections, "Events"); ev != nil {
+			for _, l := range ev.Lines {
+				if strings.HasPrefix(l, "Dialogue:") {
+					n++
+				}
+			}
+		}
+	} else {
+		blocks, _, err := ConvertToSRT(format, []byte(text), opts)
+		if err != nil {
+			return format, 0, err
+		}
+		n = len(blocks)
+	}
+	if n == 0 {
+		return format, 0, fmt.Errorf("tidak ada subtitle yang terbaca")
+	}
+	return format, n, nil
+}
+
+// Convert reads inputPath and returns the converted subtitle in opts.Format
+// (for .ass input, the resampled script) together with the warnings of its
+// parse. Nothing is written to disk; -split-at and -also-srt are not applied.
+func Convert(inputPath string, opts Options) (string, []Warning, error) {
+	if err := opts.Prepare(); err != nil {
+		return "", nil, err
+	}
+	format, raw, err := readInput(inputPath, opts)
+	if err != nil {
+		return "", nil, err
+	}
+	opts.sourceFormat = format
+	if format == "ass" {
+		out, err := resampleInput(raw, opts)
+		return out, nil, err
+	}
+	blocks, warns, err := parseBlocks(format, raw, opts)
+	if err != nil {
+		return "", warns, err
+	}
+	if blocks, err = transformBlocks(blocks, opts); err != nil {
+		return "", warns, err
+	}
+	_, content := renderOutput(blocks, opts)
+	return content, warns, nil
+}
+
+// ProcessFile converts (or, for .ass input, resamples) a single file and
+// writes the result next to it, or into opts.OutDir. With StdioPath the
+// result goes to stdout, and a Log set to stdout is moved to stderr so it
+// doesn't end up in the subtitle.
+func ProcessFile(inputPath string, opts Options) error {
+	if err := opts.Prepare(); err != nil {
+		return err
+	}
+	if inputPath == StdioPath {
+		if opts.AlsoSRT || len(opts.SplitAt) > 0 {
+			return fmt.Errorf("-also-srt dan -split-at tidak bisa dipakai dengan input dari stdin")
+		}
+		if opts.Log == os.Stdout {
+			opts.Log = os.Stderr
+		}
+	}
+	format, raw, err := readInput(inputPath, opts)
+	if err != nil {
+		return err
+	}
+	opts.sourceFormat = format
+
+	if format == "ass" {
+		if inputPath == StdioPath {
+			out, err := resampleInput(raw, opts)
+			if err != nil {
+				return err
+			}
+			return writeOutput(StdioPath, out, opts)
+		}
+		outPath := nextOutputPath(inputPath, opts.OutDir, ".ass")
+		defer releaseOutputPath(outPath)
+		if err := ResampleASSFile(inputPath, outPath, opts.ResX, opts.ResY, opts); err != nil {
+			return fmt.Errorf("gagal menormalisasi file ASS:\n%w", err)
+		}
+		opts.logln("✅ Berhasil menormalisasi:", filepath.Base(inputPath), "→", filepath.Base(outPath))
+		return runPostCmd(outPath, opts)
+	}
+
+	blocks, _, err := parseBlocks(format, raw, opts)
+	if err != nil {
+		return err
+	}
+
+	if opts.Audit {
+		report := auditTimeJumps(blocks)
+		if len(report) == 0 {
+			opts.logln("🔎 Audit", filepath.Base(inputPath)+": tidak ada masalah ditemukan.")
+			return nil
+		}
+		opts.logln("🔎 Audit", filepath.Base(inputPath)+":")
+		for _, w := range report {
+			opts.logln("  -", w)
+		}
+		return nil
+	}
+
+	if blocks, err = transformBlocks(blocks, opts); err != nil {
+		return err
+	}
+
+	if len(opts.SplitAt) == 0 {
+		return writeResult(inputPath, "", blocks, opts)
+	}
+	for i, part := range splitAtTimes(blocks, opts.SplitAt, opts.Rebase) {
+		if len(part) == 0 {
+			opts.logf("⚠️ Bagian %d kosong, tidak ditulis\n", i+1)
+			continue
+		}
+		if err := writeResult(inputPath, fmt.Sprintf("_part%d", i+1), part, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readInput loads inputPath (stdin for "-") and works out its format from
+// -informat or the extension.
+func readInput(inputPath string, opts Options) (string, []byte, error) {
+	format := inputFormat(inputPath, opts)
+	var raw []byte
+	var err error
+	if inputPath == StdioPath {
+		if opts.InputFormat == "" && opts.TextFormat == "" {
+			return "", nil, fmt.Errorf("input dari stdin butuh -informat, mis. -informat vtt")
+		}
+		raw, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		raw, err = ioutil.ReadFile(inputPath)
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("gagal membaca file input: %w", err)
+	}
+	if opts.ValidateUTF8 && opts.Charset == "" && utf16BOM(raw) == nil && !utf8.Valid(raw) {
+		return "", nil, fmt.Errorf("%s bukan UTF-8 yang valid; simpan ulang file sebagai UTF-8 atau pilih encoding dengan -charset", filepath.Base(inputPath))
+	}
+	if format == "unknown" {
+		return "", nil, fmt.Errorf("format file tidak dikenali.\nAplikasi ini hanya mendukung %s, dan ASS", supportedFormats())
+	}
+	return format, raw, nil
+}
+
+func resampleInput(raw []byte, opts Options) (string, error) {
+	text, err := decodeText(raw, opts)
+	if err != nil {
+		return "", err
+	}
+	out, err := resampleASS(text, opts.ResX, opts.ResY, opts)
+	if err != nil {
+		return "", fmt.Errorf("gagal menormalisasi file ASS:\n%w", err)
+	}
+	return out, nil
+}
+
+// parseBlocks decodes and parses the input, reports parse warnings (fatal
+// with -strict) and assigns styles. The warnings are also returned.
+func parseBlocks(format string, raw []byte, opts Options) ([]SRTBlock, []Warning, error) {
+	text, err := decodeText(raw, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	blocks, warns, err := ConvertToSRT(format, []byte(text), opts)
+	if err != nil {
+		return nil, warns, fmt.Errorf("gagal membaca subtitle:\n%w", err)
+	}
+	if len(blocks) == 0 {
+		warns = append(warns, Warning{Msg: "tidak ada subtitle yang terbaca"})
+	}
+	if len(warns) > 0 {
+		var msgs []string
+		for _, w := range warns {
+			msgs = append(msgs, w.String())
+		}
+		if opts.Strict {
+			return nil, warns, fmt.Errorf("konversi dibatalkan (-strict):\n%s", strings.Join(msgs, "\n"))
+		}
+		opts.logln("⚠️ Peringatan:\n" + strings.Join(msgs, "\n"))
+	}
+	if kept, n := dropDuplicateCues(blocks); n > 0 {
+		if opts.DedupFile {
+			blocks = kept
+			opts.logf("✂️ %d cue duplikat dibuang\n", n)
+		} else {
+			opts.logf("⚠️ %d cue muncul dua kali dengan waktu dan teks yang sama (isi file tergandakan?); pakai -dedup-file untuk membuangnya\n", n)
+		}
+	}
+
+	// Style detection; cues with nothing visible (only tags or spaces) are
+	// dropped instead of becoming invisible Dialogue lines
+	kept := blocks[:0]
+	for _, b := range blocks {
+		if opts.StripTags {
+			b.Text = reTagBlock.ReplaceAllString(b.Text, "")
+		}
+		if opts.NormalizeNFC {
+			b.Text = norm.NFC.String(b.Text)
+		}
+		if opts.StripSpeakers {
+			b.Text = stripSpeakers(b.Text, opts.speakers)
+		}
+		b.Text = normalizeAlignmentTags(b.Text)
+		if !opts.KeepEmptyLines {
+			b.Text = dropEmptyLines(b.Text)
+		}
+		if visibleText(stripFontTags(b.Text)) == "" {
+			continue
+		}
+		b.Style = detectStyle(b.Text)
+		kept = append(kept, b)
+	}
+	if n := len(blocks) - len(kept); n > 0 {
+		opts.logf("✂️ %d cue tanpa teks yang terlihat dibuang\n", n)
+	}
+	if report := validateBlocks(kept); len(report) > 0 {
+		opts.logln("⚠️ Periksa timing:")
+		for _, w := range report {
+			opts.logln("  -", w)
+		}
+	}
+	return kept, warns, nil
+}
+
+// transformBlocks applies -rate-scale and -shift, the timing fixes and
+// merges, sorts the events and cuts them down to -sample.
+func transformBlocks(blocks []SRTBlock, opts Options) ([]SRTBlock, error) {
+	if f := opts.timeScale(); f != 1 {
+		rescaleTimings(blocks, f)
+	}
+	if opts.Shift != 0 {
+		shiftBlocks(blocks, opts.Shift)
+	}
+
+	if opts.MaxCueDur > 0 {
+		if n := capDurations(blocks, opts.MaxCueDur); n > 0 {
+			opts.logf("✂️ %d cue dipotong ke %s\n", n, opts.MaxCueDur)
+		}
+	}
+
+	if opts.MinCueInterval > 0 {
+		n := len(blocks)
+		blocks = joinDenseCues(blocks, opts.MinCueInterval)
+		if n > len(blocks) {
+			opts.logf("✂️ %d cue rapat digabung menjadi %d\n", n, len(blocks))
+		}
+	}
+
+	if opts.DropRepeats {
+		repeated := 0
+		for i := range blocks {
+			var n int
+			blocks[i].Text, n = dropRepeatedLines(blocks[i].Text)
+			repeated += n
+		}
+		if repeated > 0 {
+			opts.logf("✂️ %d baris berulang di dalam cue dibuang\n", repeated)
+		}
+	}
+
+	// Merge dan efek
+	blocks = mergeSameOrContinuous(blocks, opts.Tolerance, opts.MaxMergeDur, opts.NoMergeTanda)
+	blocks = mergeSameTimeAndStyle(blocks, opts.SameTime)
+	if opts.TwoPassMerge {
+		// a merge can line up new repeats or same-time pairs; bounded in case
+		// the two steps keep trading blocks
+		for pass := 0; pass < 8; pass++ {
+			n := len(blocks)
+			blocks = mergeSameOrContinuous(blocks, opts.Tolerance, opts.MaxMergeDur, opts.NoMergeTanda)
+			blocks = mergeSameTimeAndStyle(blocks, opts.SameTime)
+			if len(blocks) == n {
+				break
+			}
+		}
+	}
+	if opts.MinDur > 0 || opts.MaxDur > 0 {
+		extended, capped := enforceDurations(blocks, opts.MinDur, opts.MaxDur)
+		if extended > 0 {
+			opts.logf("⏱️ %d cue diperpanjang ke minimal %s\n", extended, opts.MinDur)
+		}
+		if capped > 0 {
+			opts.logf("✂️ %d cue dipotong ke %s\n", capped, opts.MaxDur)
+		}
+	}
+	if opts.FixOverlap {
+		if n := fixOverlaps(blocks, opts.OverlapGap); n > 0 {
+			opts.logf("✂️ %d cue dipendekkan agar tidak tumpang tindih\n", n)
+		}
+	}
+	if opts.MaxCPS > 0 {
+		if opts.CPSFix {
+			if n := fixCPS(blocks, opts.MaxCPS); n > 0 {
+				opts.logf("⏱️ %d cue diperpanjang agar tidak melebihi %g CPS\n", n, opts.MaxCPS)
+			}
+		}
+		fast := 0
+		for _, b := range blocks {
+			if cueCPS(b) > opts.MaxCPS {
+				fast++
+			}
+		}
+		if fast > 0 {
+			opts.logf("⚠️ %d cue melebihi %g karakter per detik\n", fast, opts.MaxCPS)
+		}
+	}
+	if err := sortEvents(blocks, opts.SortBy); err != nil {
+		return nil, err
+	}
+	if opts.Sample > 0 && len(blocks) > opts.Sample {
+		blocks = blocks[:opts.Sample]
+	}
+	return blocks, nil
+}
+
+// writeResult writes blocks in the -format output (plus the -also-srt
+// companion) as <name>_Limenime<suffix>.<ext>.
+func writeResult(inputPath, suffix string, blocks []SRTBlock, opts Options) error {
+	ext, content := renderOutput(blocks, opts)
+	if inputPath == StdioPath {
+		return writeOutput(StdioPath, content, opts)
+	}
+	outPath := nextOutputPath(inputPath, opts.OutDir, suffix+ext)
+	defer releaseOutputPath(outPath)
+	if err := refuseOverwrite(inputPath, outPath); err != nil {
+		return err
+	}
+	if err := writeOutput(outPath, content, opts); err != nil {
+		return fmt.Errorf("gagal menulis output:\n%w", err)
+	}
+	opts.logln("✅ Berhasil mengonversi:", filepath.Base(inputPath), "→", filepath.Base(outPath))
+	if err := runPostCmd(outPath, opts); err != nil {
+		return err
+	}
+
+	if opts.AlsoSRT && ext != ".srt" {
+		srtPath := nextOutputPath(inputPath, opts.OutDir, suffix+".srt")
+		defer releaseOutputPath(srtPath)
+		if err := refuseOverwrite(inputPath, srtPath); err != nil {
+			return err
+		}
+		if err := writeOutput(srtPath, generateSRT(blocks), opts); err != nil {
+			return fmt.Errorf("gagal menulis SRT:\n%w", err)
+		}
+		opts.logln("✅ SRT pendamping:", filepath.Base(srtPath))
+		if err := runPostCmd(srtPath, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renderOutput generates the file for the -format option and returns it with
+// its extension.
+func renderOutput(blocks []SRTBlock, opts Options) (ext, content string) {
+	switch opts.Format {
+	case "srt":
+		return ".srt", generateSRT(blocks)
+	case "vtt":
+		return ".vtt", generateVTT(blocks)
+	default:
+		return ".ass", generateASS(blocks, opts)
+	}
+}
+
+// postCmdVar is the environment variable holding the output path for
+// -post-cmd.
+const postCmdVar = "LIMESUB_OUTPUT"
+
+// runPostCmd runs the -post-cmd template for a written output through the
+// system shell. {{.Output}} expands to a reference to postCmdVar rather than
+// to the path itself, so a downloaded file named "x$(touch PWNED).srt" is never
+// parsed as shell code; cmd.exe runs with delayed expansion (!VAR!) for the
+// same reason with & and |. A failing command is reported and only stops the
+// conversion with -strict.
+func runPostCmd(output string, opts Options) error {
+	if opts.postCmd == nil {
+		return nil
+	}
+	ref := "${" + postCmdVar + "}"
+	if runtime.GOOS == "windows" {
+		ref = "!" + postCmdVar + "!"
+	}
+	var line strings.Builder
+	if err := opts.postCmd.Execute(&line, struct{ Output string }{ref}); err != nil {
+		return fmt.Errorf("gagal menyusun -post-cmd: %w", err)
+	}
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/V:ON", "/C", line.String())
+	} else {
+		cmd = exec.Command("sh", "-c", line.String())
+	}
+	cmd.Env = append(os.Environ(), postCmdVar+"="+output)
+	var stderr bytes.Buffer
+	cmd.Stdout = opts.Log
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err == nil {
+		return nil
+	}
+	msg := fmt.Sprintf("-post-cmd untuk %s gagal (%v)", filepath.Base(output), err)
+	if s := strings.TrimSpace(stderr.String()); s != "" {
+		msg += ":\n" + s
+	}
+	if opts.Strict {
+		return fmt.Errorf("%s", msg)
+	}
+	opts.logln("⚠️", msg)
+	return nil
+}
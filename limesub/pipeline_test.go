@@ -0,0 +1,1016 @@
+package limesub
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/japanese"
+)
+
+func writeTemp(t *testing.T, name, content string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestConvertReturnsWarningsPerCall(t *testing.T) {
+	clean := writeTemp(t, "clean.srt", "1\n00:00:01,000 --> 00:00:02,000\nhello\n")
+	broken := writeTemp(t, "broken.srt", "1\n00:00:01,000 --> 00:00:02,000\nhello\n\njunk\n")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, warns, err := Convert(clean, DefaultOptions())
+			if err != nil || len(warns) != 0 {
+				t.Errorf("clean: warns %v, err %v", warns, err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			_, warns, err := Convert(broken, DefaultOptions())
+			if err != nil || len(warns) != 1 {
+				t.Errorf("broken: warns %v, err %v", warns, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestRefuseOverwrite(t *testing.T) {
+	in := writeTemp(t, "ep.ass", "[Script Info]\n")
+	dir := filepath.Dir(in)
+	link := filepath.Join(dir, "ep_Limenime.ass")
+	if err := os.Link(in, link); err != nil {
+		t.Skip("hard links not supported:", err)
+	}
+	other := writeTemp(t, "ep_Limenime(1).ass", "")
+	tests := []struct {
+		name, output string
+		wantErr      bool
+	}{
+		{"same path", in, true},
+		{"same path, not clean", filepath.Join(dir, ".", "sub", "..", "ep.ass"), true},
+		{"hard link to the input", link, true},
+		{"other file", other, false},
+		{"new file", filepath.Join(dir, "new.ass"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := refuseOverwrite(in, tt.output); (err != nil) != tt.wantErr {
+				t.Errorf("refuseOverwrite(%q) = %v, wantErr %v", tt.output, err, tt.wantErr)
+			}
+		})
+	}
+
+	// resampling an .ass in place must leave the source alone
+	if err := ResampleASSFile(in, in, 1920, 1080, DefaultOptions()); err == nil {
+		t.Error("ResampleASSFile onto its own input should fail")
+	}
+	if data, _ := os.ReadFile(in); string(data) != "[Script Info]\n" {
+		t.Errorf("input was rewritten: %q", data)
+	}
+}
+
+func TestExpandInputs(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"[SubsPlease] Show - 01.srt", "a.srt", "b.srt", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bracketed := filepath.Join(dir, "[SubsPlease] Show - 01.srt")
+	tests := []struct {
+		name      string
+		args      []string
+		inputs    []string
+		unmatched []string
+	}{
+		{"bracketed file name is literal", []string{bracketed}, []string{bracketed}, nil},
+		{"wildcard", []string{filepath.Join(dir, "?.srt")}, []string{filepath.Join(dir, "a.srt"), filepath.Join(dir, "b.srt")}, nil},
+		{"no match", []string{filepath.Join(dir, "*.vtt")}, nil, []string{filepath.Join(dir, "*.vtt")}},
+		{"missing plain file", []string{"missing.srt"}, []string{"missing.srt"}, nil},
+		{"stdin", []string{StdioPath}, []string{StdioPath}, nil},
+		{"folder", []string{dir}, []string{filepath.Join(dir, "[SubsPlease] Show - 01.srt"), filepath.Join(dir, "a.srt"), filepath.Join(dir, "b.srt")}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inputs, unmatched := ExpandInputs(tt.args, false)
+			if !reflect.DeepEqual(inputs, tt.inputs) || !reflect.DeepEqual(unmatched, tt.unmatched) {
+				t.Errorf("ExpandInputs(%q) = %q, %q; want %q, %q", tt.args, inputs, unmatched, tt.inputs, tt.unmatched)
+			}
+		})
+	}
+}
+
+func TestConvert(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Format = "srt"
+	out, _, err := Convert("testdata/basic.srt", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "1\n00:00:01,000 --> 00:00:03,000\nHello there.\n\n2\n00:00:04,000 --> 00:00:05,000\nTOKYO STATION\n\n"
+	if out != want {
+		t.Errorf("Convert = %q, want %q", out, want)
+	}
+	if _, err := os.Stat("testdata/basic_Limenime.srt"); !os.IsNotExist(err) {
+		t.Errorf("Convert wrote a file: %v", err)
+	}
+	if _, _, err := Convert("testdata/missing.srt", opts); err == nil {
+		t.Error("want an error for a missing input")
+	}
+}
+
+func TestConvertSRTWithASSTags(t *testing.T) {
+	tests := []struct {
+		name      string
+		stripTags bool
+		want      []string
+	}{
+		{"respected", false, []string{
+			",Default,,0,0,0,,{\\blur3\\fad(00,40)\\an8}Top line\n",
+			",tanda,,0,0,0,,{\\an8}STATION SIGN\n",
+			",Default,,0,0,0,,{\\blur3}{\\fad(00,40)}Plain line\n",
+		}},
+		{"stripped", true, []string{
+			",Default,,0,0,0,,{\\blur3}{\\fad(00,40)}Top line\n",
+			",tanda,,0,0,0,,STATION SIGN\n",
+			",Default,,0,0,0,,{\\blur3}{\\fad(00,40)}Plain line\n",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.StripTags = tt.stripTags
+			out, _, err := Convert("testdata/an8.srt", opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(out, want) {
+					t.Errorf("output lacks %q:\n%s", want, out)
+				}
+			}
+			// the tag-only cue has nothing to show
+			if n := strings.Count(out, "\nDialogue:"); n != 3 {
+				t.Errorf("%d Dialogue lines, want 3", n)
+			}
+		})
+	}
+}
+
+func TestConvertSample(t *testing.T) {
+	var sb strings.Builder
+	for i := 0; i < 10; i++ {
+		fmt.Fprintf(&sb, "%d\n00:00:%02d,000 --> 00:00:%02d,500\nLine %d\n\n", i+1, i*2, i*2, i+1)
+	}
+	// the first two repeat and merge, so the sample counts merged events
+	in := writeTemp(t, "long.srt", strings.Replace(sb.String(), "Line 2", "Line 1", 1))
+	tests := []struct{ sample, want int }{{0, 9}, {3, 3}, {20, 9}}
+	for _, tt := range tests {
+		opts := DefaultOptions()
+		opts.Tolerance = 2 * time.Second
+		opts.Sample = tt.sample
+		out, _, err := Convert(in, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := strings.Count(out, "\nDialogue:"); n != tt.want {
+			t.Errorf("-sample %d: %d events, want %d", tt.sample, n, tt.want)
+		}
+		if tt.sample == 3 && (!strings.Contains(out, "0:00:00.00,0:00:02.50,") || !strings.Contains(out, "}Line 4\n") || strings.Contains(out, "Line 5")) {
+			t.Errorf("-sample 3 should keep the first three merged events:\n%s", out)
+		}
+	}
+	opts := DefaultOptions()
+	opts.Sample = -1
+	if err := opts.Prepare(); err == nil {
+		t.Error("want an error for a negative -sample")
+	}
+}
+
+func TestConvertTandaCase(t *testing.T) {
+	in := writeTemp(t, "signs.srt", "1\n00:00:01,000 --> 00:00:02,000\n[Tokyo Station]\n\n2\n00:00:03,000 --> 00:00:04,000\nMixed dialogue\n")
+	opts := DefaultOptions()
+	opts.TandaCase = "upper"
+	out, _, err := Convert(in, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{",tanda,,0,0,0,,[TOKYO STATION]\n", "}Mixed dialogue\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestConvertDoubledFile(t *testing.T) {
+	tests := []struct {
+		dedup bool
+		log   string
+	}{
+		{false, "4 cue muncul dua kali"},
+		{true, "4 cue duplikat dibuang"},
+	}
+	for _, tt := range tests {
+		opts := DefaultOptions()
+		opts.Format = "srt"
+		opts.DedupFile = tt.dedup
+		var log strings.Builder
+		opts.Log = &log
+		out, _, err := Convert("testdata/doubled.srt", opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := strings.Count(out, " --> "); n != 4 {
+			t.Errorf("-dedup-file=%v: %d cues, want 4:\n%s", tt.dedup, n, out)
+		}
+		if !strings.Contains(log.String(), tt.log) {
+			t.Errorf("-dedup-file=%v: log lacks %q:\n%s", tt.dedup, tt.log, log.String())
+		}
+	}
+
+	data, err := os.ReadFile("testdata/doubled.srt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks, _ := parseSRTString(string(data), nil)
+	kept, n := dropDuplicateCues(blocks)
+	if len(kept) != 4 || n != 4 {
+		t.Errorf("dropDuplicateCues kept %d and dropped %d, want 4 and 4", len(kept), n)
+	}
+}
+
+func TestRunPostCmd(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	dir := t.TempDir()
+	log := filepath.Join(dir, "invoked.txt")
+	tests := []struct {
+		name   string
+		output string
+	}{
+		{"plain", filepath.Join(dir, "a_Limenime.ass")},
+		{"spaces and brackets", filepath.Join(dir, "[Group] Show - 01_Limenime.ass")},
+		{"command substitution", filepath.Join(dir, "x$(touch PWNED)_Limenime.ass")},
+		{"backquotes and quotes", filepath.Join(dir, "x`touch PWNED`'\"_Limenime.ass")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.PostCmd = `printf %s "{{.Output}}" > '` + log + `'`
+			if err := opts.Prepare(); err != nil {
+				t.Fatal(err)
+			}
+			if err := runPostCmd(tt.output, opts); err != nil {
+				t.Fatal(err)
+			}
+			got, err := os.ReadFile(log)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.output {
+				t.Errorf("command got %q, want %q", got, tt.output)
+			}
+			if _, err := os.Stat("PWNED"); err == nil {
+				os.Remove("PWNED")
+				t.Error("file name was run as a shell command")
+			}
+		})
+	}
+}
+
+func TestRunPostCmdFailure(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	opts := DefaultOptions()
+	opts.PostCmd = "echo boom >&2; exit 3"
+	if err := opts.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	if err := runPostCmd("out.ass", opts); err != nil {
+		t.Errorf("failure without -strict should only be reported, got %v", err)
+	}
+	opts.Strict = true
+	err := runPostCmd("out.ass", opts)
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("-strict error = %v, want the command's stderr", err)
+	}
+}
+
+func TestConvertSameTimeBehavior(t *testing.T) {
+	in := writeTemp(t, "same_time.srt", "1\n00:00:01,000 --> 00:00:02,000\nFirst speaker\n\n"+
+		"2\n00:00:01,000 --> 00:00:02,000\nSecond speaker\n\n"+
+		"3\n00:00:03,000 --> 00:00:04,000\nAlone\n")
+	tests := []struct {
+		mode string
+		want []string
+	}{
+		{"join", []string{
+			"Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,{\\blur3}{\\fad(00,40)}First speaker\\NSecond speaker\n",
+		}},
+		{"keep", []string{
+			"Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,{\\blur3}{\\fad(00,40)}First speaker\n",
+			"Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,{\\blur3}{\\fad(00,40)}Second speaker\n",
+		}},
+		{"layer", []string{
+			"Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,{\\blur3}{\\fad(00,40)}First speaker\n",
+			"Dialogue: 1,0:00:01.00,0:00:02.00,Default,,0,0,0,,{\\blur3}{\\fad(00,40)}Second speaker\n",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.SameTime = tt.mode
+			out, _, err := Convert(in, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := strings.Count(out, "\nDialogue:"); n != len(tt.want)+1 {
+				t.Errorf("%d Dialogue lines, want %d:\n%s", n, len(tt.want)+1, out)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(out, want) {
+					t.Errorf("output lacks %q:\n%s", want, out)
+				}
+			}
+		})
+	}
+	opts := DefaultOptions()
+	opts.SameTime = "stack"
+	if _, _, err := Convert(in, opts); err == nil {
+		t.Error("want an error for an unknown -same-time-behavior")
+	}
+}
+
+func TestConvertDropsTagOnlyCues(t *testing.T) {
+	in := writeTemp(t, "tags.srt", "1\n00:00:01,000 --> 00:00:02,000\n{\\fs40}\n\n"+
+		"2\n00:00:03,000 --> 00:00:04,000\n{\\fnArial}{\\b1}<i> </i>\n\n"+
+		"3\n00:00:05,000 --> 00:00:06,000\n{\\fs40}Visible\n")
+	out, _, err := Convert(in, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(out, "\nDialogue:"); n != 1 {
+		t.Errorf("%d Dialogue lines, want only the visible cue:\n%s", n, out)
+	}
+	if want := "Dialogue: 0,0:00:05.00,0:00:06.00,Default,,0,0,0,,{\\blur3}{\\fad(00,40)}Visible\n"; !strings.Contains(out, want) {
+		t.Errorf("output lacks %q:\n%s", want, out)
+	}
+	if strings.Contains(out, "{}") {
+		t.Errorf("empty tag block left in output:\n%s", out)
+	}
+}
+
+func TestConvertSameTimeJoinOrder(t *testing.T) {
+	// the early cue listed last forces a sort; the three same-time lines must
+	// still join in the order the file gives them
+	in := writeTemp(t, "order.srt", "1\n00:00:05,000 --> 00:00:06,000\nCharlie\n\n"+
+		"2\n00:00:05,000 --> 00:00:06,000\nAlpha\n\n"+
+		"3\n00:00:05,000 --> 00:00:06,000\nBravo\n\n"+
+		"4\n00:00:01,000 --> 00:00:02,000\nEarlier\n")
+	want := "Dialogue: 0,0:00:05.00,0:00:06.00,Default,,0,0,0,,{\\blur3}{\\fad(00,40)}Charlie\\NAlpha\\NBravo\n"
+	for i := 0; i < 20; i++ {
+		out, _, err := Convert(in, DefaultOptions())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(out, want) {
+			t.Fatalf("run %d: output lacks %q:\n%s", i, want, out)
+		}
+	}
+}
+
+func TestConvertNormalizeUnicode(t *testing.T) {
+	in := writeTemp(t, "nfd.srt", "1\n00:00:01,000 --> 00:00:02,000\nCafe\u0301 ouvert\n")
+	tests := []struct {
+		nfc  bool
+		want string
+	}{
+		{false, "Cafe\u0301 ouvert\n"},
+		{true, "Caf\u00e9 ouvert\n"},
+	}
+	for _, tt := range tests {
+		opts := DefaultOptions()
+		opts.NormalizeNFC = tt.nfc
+		out, _, err := Convert(in, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(out, tt.want) {
+			t.Errorf("-normalize-unicode=%v: output lacks %q:\n%s", tt.nfc, tt.want, out)
+		}
+	}
+}
+
+func TestConvertStripSpeakers(t *testing.T) {
+	in := writeTemp(t, "captions.srt", "1\n00:00:01,000 --> 00:00:02,000\n[MUSIC]\n\n"+
+		"2\n00:00:03,000 --> 00:00:04,000\n>> ANNA: Good morning\n")
+	tests := []struct {
+		strip bool
+		want  []string
+	}{
+		{false, []string{",tanda,,0,0,0,,[MUSIC]\n", "}>> ANNA: Good morning\n"}},
+		{true, []string{",Default,,0,0,0,,{\\blur3}{\\fad(00,40)}Good morning\n"}},
+	}
+	for _, tt := range tests {
+		opts := DefaultOptions()
+		opts.StripSpeakers = tt.strip
+		out, _, err := Convert(in, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := strings.Count(out, "\nDialogue:"); n != len(tt.want) {
+			t.Errorf("-strip-speakers=%v: %d Dialogue lines, want %d:\n%s", tt.strip, n, len(tt.want), out)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(out, want) {
+				t.Errorf("-strip-speakers=%v: output lacks %q:\n%s", tt.strip, want, out)
+			}
+		}
+	}
+}
+
+func TestConvertCollapseTandaNewlines(t *testing.T) {
+	in := writeTemp(t, "sign.srt", "1\n00:00:01,000 --> 00:00:03,000\nSHINJUKU STATION\nEAST EXIT\n\n"+
+		"2\n00:00:04,000 --> 00:00:05,000\nFirst line\nsecond line\n")
+	tests := []struct {
+		collapse bool
+		sign     string
+	}{
+		{false, ",tanda,,0,0,0,,SHINJUKU STATION\\NEAST EXIT\n"},
+		{true, ",tanda,,0,0,0,,SHINJUKU STATION EAST EXIT\n"},
+	}
+	for _, tt := range tests {
+		opts := DefaultOptions()
+		opts.CollapseTanda = tt.collapse
+		out, _, err := Convert(in, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// dialogue keeps its \N either way
+		for _, want := range []string{tt.sign, "}First line\\Nsecond line\n"} {
+			if !strings.Contains(out, want) {
+				t.Errorf("-collapse-tanda-newlines=%v: output lacks %q:\n%s", tt.collapse, want, out)
+			}
+		}
+	}
+}
+
+func TestRequiredFontsComment(t *testing.T) {
+	tests := []struct {
+		name, font, want string
+	}{
+		{"default font", "", "; Font yang dibutuhkan: Basic Comical NC"},
+		{"custom font", "Open Sans", "; Font yang dibutuhkan: Open Sans"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.Font = tt.font
+			out, _, err := Convert("testdata/basic.srt", opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(out, tt.want+"\n") {
+				t.Errorf("missing %q in:\n%s", tt.want, out)
+			}
+		})
+	}
+}
+
+func TestRegisterParser(t *testing.T) {
+	RegisterParser("DUMMY", func(data []byte, _ Options) ([]SRTBlock, []Warning, error) {
+		var blocks []SRTBlock
+		for i, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+			start := ms(i * 2000)
+			blocks = append(blocks, SRTBlock{Start: start, End: start + ms(1500), Text: line})
+		}
+		return blocks, nil, nil
+	})
+	t.Cleanup(func() { delete(parsers, ".dummy") })
+
+	if !strings.Contains(supportedFormats(), "DUMMY") {
+		t.Errorf("supportedFormats() = %q, want DUMMY listed", supportedFormats())
+	}
+	in := writeTemp(t, "ep.dummy", "first\nsecond\n")
+	out, _, err := Convert(in, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"Dialogue: 0,0:00:00.00,0:00:01.50,Default,,0,0,0,,{\\blur3}{\\fad(00,40)}first\n",
+		"Dialogue: 0,0:00:02.00,0:00:03.50,Default,,0,0,0,,{\\blur3}{\\fad(00,40)}second\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestConvertCollapseSpaces(t *testing.T) {
+	in := writeTemp(t, "a.srt", "1\n00:00:01,000 --> 00:00:02,000\nwide  gap   here\n")
+	tests := []struct {
+		collapse bool
+		want     string
+	}{
+		{false, "}wide  gap   here\n"},
+		{true, "}wide gap here\n"},
+	}
+	for _, tt := range tests {
+		opts := DefaultOptions()
+		opts.CollapseSpaces = tt.collapse
+		out, _, err := Convert(in, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(out, tt.want) {
+			t.Errorf("-collapse-spaces=%v: want %q in:\n%s", tt.collapse, tt.want, out)
+		}
+	}
+}
+
+func TestConvertStrict(t *testing.T) {
+	in := writeTemp(t, "bad.srt", "1\n00:00:01,000 --> 00:00:02,000\nfine\n\n"+
+		"2\n00:00:xx,000 --> 00:00:04,000\nbad timestamp\n")
+	opts := DefaultOptions()
+	out, warns, err := Convert(in, opts)
+	if err != nil || len(warns) != 1 || !strings.Contains(out, "fine") {
+		t.Fatalf("without -strict: warns %v, err %v", warns, err)
+	}
+	opts.Strict = true
+	if _, _, err := Convert(in, opts); err == nil || !strings.Contains(err.Error(), "-strict") {
+		t.Errorf("with -strict: err = %v, want the conversion aborted", err)
+	}
+	if err := ProcessFile(in, opts); err == nil {
+		t.Error("ProcessFile with -strict should fail")
+	}
+	if matches, _ := filepath.Glob(filepath.Join(filepath.Dir(in), "*_Limenime*")); len(matches) > 0 {
+		t.Errorf("-strict still wrote %v", matches)
+	}
+}
+
+func TestProcessFileAlsoSRT(t *testing.T) {
+	in := writeTemp(t, "ep01.srt", "1\n00:00:01,000 --> 00:00:02,000\n{\\an8}<i>hello</i>\n")
+	outDir := filepath.Join(t.TempDir(), "out")
+	opts := DefaultOptions()
+	opts.AlsoSRT = true
+	opts.OutDir = outDir
+	for run := 0; run < 2; run++ {
+		if err := ProcessFile(in, opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"ep01_Limenime.ass", "ep01_Limenime.srt", "ep01_Limenime(1).ass", "ep01_Limenime(1).srt"} {
+		if _, err := os.Stat(filepath.Join(outDir, name)); err != nil {
+			t.Errorf("missing %s: %v", name, err)
+		}
+	}
+	srt, err := os.ReadFile(filepath.Join(outDir, "ep01_Limenime.srt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "1\n00:00:01,000 --> 00:00:02,000\n<i>hello</i>\n"; !strings.HasPrefix(string(srt), want) {
+		t.Errorf("companion SRT = %q, want it to start with %q", srt, want)
+	}
+}
+
+func TestConvertTemplate(t *testing.T) {
+	opts := DefaultOptions()
+	opts.TemplatePath = "testdata/template.ass"
+	out, _, err := Convert("testdata/basic.srt", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"Title: Group Kit\n",
+		"\nStyle: Main,Gandhi Sans,66,",
+		"\nStyle: Signs,Arial,60,",
+		",Main,,0,0,0,,{\\blur3}{\\fad(00,40)}Hello there.\n",
+		",Signs,,0,0,0,,TOKYO STATION\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+	for _, unwanted := range []string{"Style: Default,", "Style: tanda,", "template line"} {
+		if strings.Contains(out, unwanted) {
+			t.Errorf("output should not contain %q:\n%s", unwanted, out)
+		}
+	}
+}
+
+func TestProcessFileShiftJIS(t *testing.T) {
+	in := writeTemp(t, "jp.srt", "1\n00:00:01,000 --> 00:00:02,000\nこんにちは、世界\n\n2\n00:00:03,000 --> 00:00:04,000\n한국어\n")
+	opts := DefaultOptions()
+	opts.OutputEncoding = "shift_jis"
+	if err := ProcessFile(in, opts); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := os.ReadFile(filepath.Join(filepath.Dir(in), "jp_Limenime.ass"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if utf8.Valid(raw) {
+		t.Fatal("output is still UTF-8")
+	}
+	text, err := japanese.ShiftJIS.NewDecoder().Bytes(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(text), "}こんにちは、世界\n") {
+		t.Errorf("Japanese line did not survive the round trip:\n%s", text)
+	}
+	// Hangul has no Shift-JIS mapping and is replaced rather than aborting
+	if strings.Contains(string(text), "한국어") {
+		t.Errorf("unrepresentable text was written as is:\n%s", text)
+	}
+}
+
+func TestProcessFileShiftJISResample(t *testing.T) {
+	in := writeTemp(t, "jp.ass", "[Script Info]\nPlayResX: 1920\nPlayResY: 1080\n\n[Events]\n"+
+		"Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text\n"+
+		"Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,こんにちは\n")
+	opts := DefaultOptions()
+	opts.OutputEncoding = "shift_jis"
+	if err := ProcessFile(in, opts); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := os.ReadFile(filepath.Join(filepath.Dir(in), "jp_Limenime.ass"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := japanese.ShiftJIS.NewDecoder().Bytes(raw)
+	if err != nil || utf8.Valid(raw) {
+		t.Fatalf("resampled output is not Shift-JIS (err %v)", err)
+	}
+	if !strings.Contains(string(text), ",,こんにちは\n") {
+		t.Errorf("Japanese line did not survive the round trip:\n%s", text)
+	}
+}
+
+func TestConvertInvalidUTF8(t *testing.T) {
+	// "café" saved as Latin-1
+	in := writeTemp(t, "latin1.srt", "1\n00:00:01,000 --> 00:00:02,000\ncaf\xe9\n")
+	tests := []struct {
+		name     string
+		validate bool
+		charset  string
+		wantErr  string
+		wantText string
+	}{
+		{"windows-1252 fallback", false, "", "", "café"},
+		{"rejected", true, "", "-charset", ""},
+		{"charset given", true, "latin1", "", "café"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.ValidateUTF8 = tt.validate
+			opts.Charset = tt.charset
+			out, _, err := Convert(in, opts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) || !strings.Contains(err.Error(), "latin1.srt") {
+					t.Errorf("err = %v, want one naming the file and %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(out, tt.wantText+"\n") {
+				t.Errorf("output lacks %q:\n%s", tt.wantText, out)
+			}
+		})
+	}
+}
+
+func TestConvertTwoPassMerge(t *testing.T) {
+	// pass one stacks the same-time "Hi" and "Yo" after the repeat merge has
+	// already run; only a second pass sees that the result continues into
+	// cue 3
+	tests := []struct {
+		twoPass bool
+		want    []string
+	}{
+		{false, []string{
+			"Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,{\\blur3}{\\fad(00,40)}Hi\\NYo\n",
+			"Dialogue: 0,0:00:02.00,0:00:03.00,Default,,0,0,0,,{\\blur3}{\\fad(00,40)}Hi\\NYo\n",
+		}},
+		{true, []string{
+			"Dialogue: 0,0:00:01.00,0:00:03.00,Default,,0,0,0,,{\\blur3}{\\fad(00,40)}Hi\\NYo\n",
+		}},
+	}
+	for _, tt := range tests {
+		opts := DefaultOptions()
+		opts.TwoPassMerge = tt.twoPass
+		out, _, err := Convert("testdata/two_pass.srt", opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := strings.Count(out, "\nDialogue:"); n != len(tt.want) {
+			t.Errorf("-two-pass-merge=%v: %d Dialogue lines, want %d:\n%s", tt.twoPass, n, len(tt.want), out)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(out, want) {
+				t.Errorf("-two-pass-merge=%v: output lacks %q:\n%s", tt.twoPass, want, out)
+			}
+		}
+	}
+}
+
+func TestConvertMinCueInterval(t *testing.T) {
+	tests := []struct {
+		interval time.Duration
+		want     string
+	}{
+		{0, "10\n00:00:01,800 --> 00:00:02,100\nweather\n\n11\n00:00:05,000 --> 00:00:06,500\nokay\n\n"},
+		{time.Second, "1\n00:00:00,000 --> 00:00:01,100\nso today we are going\n\n" +
+			"2\n00:00:01,000 --> 00:00:02,100\nto talk about the weather\n\n" +
+			"3\n00:00:05,000 --> 00:00:06,500\nokay\n\n"},
+	}
+	for _, tt := range tests {
+		opts := DefaultOptions()
+		opts.Format = "srt"
+		opts.MinCueInterval = tt.interval
+		out, _, err := Convert("testdata/dense_asr.json", opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasSuffix(out, tt.want) {
+			t.Errorf("-min-cue-interval %s: got\n%s\nwant it to end with\n%s", tt.interval, out, tt.want)
+		}
+	}
+}
+
+func TestConvertKeepEmptyLines(t *testing.T) {
+	in := writeTemp(t, "art.srt", "1\n00:00:01,000 --> 00:00:03,000\no   o\\N\\N  ---\n")
+	tests := []struct {
+		keep bool
+		want string
+	}{
+		{false, "}o   o\\N  ---\n"},
+		{true, "}o   o\\N\\N  ---\n"},
+	}
+	for _, tt := range tests {
+		opts := DefaultOptions()
+		opts.KeepEmptyLines = tt.keep
+		out, _, err := Convert(in, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(out, tt.want) {
+			t.Errorf("-keep-empty-lines=%v: want %q in:\n%s", tt.keep, tt.want, out)
+		}
+	}
+}
+
+func TestConvertDropRepeatedLines(t *testing.T) {
+	in := writeTemp(t, "asr.srt", "1\n00:00:01,000 --> 00:00:03,000\nwe go now\nWe  go now\nthen stop\n")
+	tests := []struct {
+		drop bool
+		want string
+	}{
+		{false, "}we go now\\NWe  go now\\Nthen stop\n"},
+		{true, "}we go now\\Nthen stop\n"},
+	}
+	for _, tt := range tests {
+		opts := DefaultOptions()
+		opts.DropRepeats = tt.drop
+		out, _, err := Convert(in, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(out, tt.want) {
+			t.Errorf("-drop-repeated-lines=%v: want %q in:\n%s", tt.drop, tt.want, out)
+		}
+	}
+}
+
+func TestProcessFileSplitAt(t *testing.T) {
+	in := writeTemp(t, "ep.srt", "1\n00:00:01,000 --> 00:00:02,000\nOpening\n\n"+
+		"2\n00:00:09,500 --> 00:00:11,000\nAcross the cut\n\n"+
+		"3\n00:00:12,000 --> 00:00:13,000\nMiddle\n\n"+
+		"4\n00:00:25,000 --> 00:00:26,000\nEnding\n")
+	for _, rebase := range []bool{false, true} {
+		t.Run(fmt.Sprintf("rebase=%v", rebase), func(t *testing.T) {
+			opts := DefaultOptions()
+			fs := flag.NewFlagSet("limesub", flag.ContinueOnError)
+			BindFlags(fs, &opts)
+			if err := fs.Parse([]string{"-split-at", "0:00:20,0:00:10", "-format", "srt", "-outdir", t.TempDir()}); err != nil {
+				t.Fatal(err)
+			}
+			opts.Rebase = rebase
+			if err := ProcessFile(in, opts); err != nil {
+				t.Fatal(err)
+			}
+			want := map[string]string{
+				"ep_Limenime_part1.srt": "1\n00:00:01,000 --> 00:00:02,000\nOpening\n\n2\n00:00:09,500 --> 00:00:11,000\nAcross the cut\n\n",
+				"ep_Limenime_part2.srt": "1\n00:00:12,000 --> 00:00:13,000\nMiddle\n\n",
+				"ep_Limenime_part3.srt": "1\n00:00:25,000 --> 00:00:26,000\nEnding\n\n",
+			}
+			if rebase {
+				want["ep_Limenime_part2.srt"] = "1\n00:00:02,000 --> 00:00:03,000\nMiddle\n\n"
+				want["ep_Limenime_part3.srt"] = "1\n00:00:05,000 --> 00:00:06,000\nEnding\n\n"
+			}
+			for name, content := range want {
+				got, err := os.ReadFile(filepath.Join(opts.OutDir, name))
+				if err != nil {
+					t.Error(err)
+					continue
+				}
+				if string(got) != content {
+					t.Errorf("%s = %q, want %q", name, got, content)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateFile(t *testing.T) {
+	tests := []struct {
+		name, file, content string
+		format              string
+		blocks              int
+		wantErr             bool
+	}{
+		{"srt", "a.srt", "1\n00:00:01,000 --> 00:00:02,000\nhi\n\n2\n00:00:03,000 --> 00:00:04,000\nthere\n", "srt", 2, false},
+		{"ass", "a.ass", "[Script Info]\n\n[Events]\nFormat: Layer, Start, End, Style, Text\nDialogue: 0,0:00:01.00,0:00:02.00,Default,hi\n", "ass", 1, false},
+		{"no cues", "empty.srt", "\n\n", "srt", 0, true},
+		{"broken json", "bad.json", "{\"events\": [", "json", 0, true},
+		{"unknown extension", "notes.docx", "hello", "unknown", 0, true},
+		{"ass without events", "bare.ass", "[Script Info]\nTitle: x\n", "ass", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTemp(t, tt.file, tt.content)
+			format, n, err := ValidateFile(path, DefaultOptions())
+			if (err != nil) != tt.wantErr || format != tt.format || n != tt.blocks {
+				t.Errorf("ValidateFile = %q, %d, %v; want %q, %d, error %v", format, n, err, tt.format, tt.blocks, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateFileStdin(t *testing.T) {
+	in, err := os.Open(writeTemp(t, "cues.vtt", "WEBVTT\n\n00:01.000 --> 00:02.000\nhi\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	stdin := os.Stdin
+	os.Stdin = in
+	defer func() { os.Stdin = stdin }()
+	opts := DefaultOptions()
+	opts.InputFormat = "vtt"
+	format, n, err := ValidateFile(StdioPath, opts)
+	if err != nil || format != "vtt" || n != 1 {
+		t.Errorf("ValidateFile(-) = %q, %d, %v; want \"vtt\", 1, nil", format, n, err)
+	}
+}
+
+func TestConvertLiteralBraces(t *testing.T) {
+	in := writeTemp(t, "braces.srt", "1\n00:00:01,000 --> 00:00:02,000\nuse {brackets} here\n\n2\n00:00:03,000 --> 00:00:04,000\n{\\an8}on top\n")
+	out, _, err := Convert(in, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"}use \\{brackets\\} here\n", "\\an8}on top\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestConvertTTMLSavedAsXML(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Format = "srt"
+	out, warns, err := Convert("testdata/ttml_as.xml", opts)
+	if err != nil || len(warns) > 0 {
+		t.Fatalf("warns %v, err %v", warns, err)
+	}
+	want := "1\n00:00:01,000 --> 00:00:02,500\nFirst line\n\n2\n00:00:03,000 --> 00:00:04,000\nSecond\nline\n\n"
+	if out != want {
+		t.Errorf("got %q, want %q", out, want)
+	}
+	if !isTTML([]byte("<?xml version=\"1.0\"?>\n<!-- c -->\n<tt/>")) || isTTML([]byte("<transcript><text start=\"1\">x</text></transcript>")) {
+		t.Error("isTTML should only accept a <tt> root element")
+	}
+}
+
+func TestProcessFileConcurrentCollidingNames(t *testing.T) {
+	const n = 12
+	outDir := t.TempDir()
+	var inputs []string
+	for i := 0; i < n; i++ {
+		inputs = append(inputs, writeTemp(t, "episode.srt", fmt.Sprintf("1\n00:00:01,000 --> 00:00:02,000\nfrom input %d\n", i)))
+	}
+	opts := DefaultOptions()
+	opts.OutDir = outDir
+	var wg sync.WaitGroup
+	for _, in := range inputs {
+		wg.Add(1)
+		go func(in string) {
+			defer wg.Done()
+			if err := ProcessFile(in, opts); err != nil {
+				t.Error(err)
+			}
+		}(in)
+	}
+	wg.Wait()
+
+	entries, err := os.ReadDir(outDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != n {
+		t.Fatalf("%d output files, want %d", len(entries), n)
+	}
+	seen := map[string]bool{}
+	for _, e := range entries {
+		data, err := os.ReadFile(filepath.Join(outDir, e.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		i := strings.Index(string(data), "from input ")
+		if i < 0 {
+			t.Fatalf("%s has no dialogue", e.Name())
+		}
+		line := strings.SplitN(string(data[i:]), "\n", 2)[0]
+		if seen[line] {
+			t.Errorf("%q written twice; one output overwrote another", line)
+		}
+		seen[line] = true
+	}
+}
+
+func TestProcessFileReleasesOutputName(t *testing.T) {
+	in := writeTemp(t, "a.srt", "1\n00:00:01,000 --> 00:00:02,000\nHi\n")
+	out := filepath.Join(filepath.Dir(in), "a_Limenime.ass")
+	for i := 0; i < 2; i++ {
+		if err := ProcessFile(in, DefaultOptions()); err != nil {
+			t.Fatal(err)
+		}
+		// once removed, the name is free again rather than held for the
+		// rest of the process
+		if err := os.Remove(out); err != nil {
+			t.Fatalf("run %d: %v", i+1, err)
+		}
+	}
+	reservedOutputs.Lock()
+	defer reservedOutputs.Unlock()
+	if len(reservedOutputs.names) != 0 {
+		t.Errorf("names still reserved: %v", reservedOutputs.names)
+	}
+}
+
+func TestAnnotateSources(t *testing.T) {
+	// #2 repeats #1, and #4 comes before #3 in time
+	in := writeTemp(t, "a.srt", "1\n00:00:01,000 --> 00:00:02,000\nAa\n\n"+
+		"2\n00:00:01,000 --> 00:00:02,000\nAa\n\n"+
+		"3\n00:00:05,000 --> 00:00:06,000\nBb\n\n"+
+		"4\n00:00:03,000 --> 00:00:04,000\nCc\n\n"+
+		"5\n00:00:06,100 --> 00:00:07,000\nBb\n")
+	opts := DefaultOptions()
+	opts.Annotate = true
+	out, _, err := Convert(in, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct{ text, source string }{
+		{"Aa", "1,2"},
+		{"Cc", "4"},
+		{"Bb", "3,5"},
+	}
+	lines := strings.Split(out, "\n")
+	for _, tt := range tests {
+		found := false
+		for i, l := range lines {
+			if strings.HasPrefix(l, "Dialogue:") && strings.HasSuffix(l, tt.text) {
+				found = true
+				if want := "source: " + tt.source; i == 0 || !strings.HasSuffix(lines[i-1], want) {
+					t.Errorf("%s: comment above is %q, want %q", tt.text, lines[i-1], want)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("no Dialogue line for %s:\n%s", tt.text, out)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/limedriveku/limesub_app/limesub"
+)
+
+// ====================== MAIN ======================
+
+func main() {
+	opts := limesub.DefaultOptions()
+	opts.Log = os.Stdout
+	limesub.BindFlags(flag.CommandLine, &opts)
+	flag.Parse()
+	if flag.NArg() < 1 {
+		MessageBox("Limesub v3", "Tidak ada file yang diberikan.\nGunakan drag & drop file subtitle ke aplikasi ini,\natau jalankan melalui Command Prompt.")
+		return
+	}
+	if err := opts.Prepare(); err != nil {
+		MessageBox("Limesub v3", err.Error())
+		os.Exit(1)
+	}
+	inputs, unmatched := limesub.ExpandInputs(flag.Args(), opts.Recursive)
+	for _, p := range unmatched {
+		fmt.Println("⚠️ Tidak ada file yang cocok dengan", p)
+	}
+	if len(inputs) == 0 {
+		MessageBox("Limesub v3", "Tidak ada file yang cocok dengan pola yang diberikan.")
+		os.Exit(1)
+	}
+	if opts.DryValidate {
+		failed := false
+		for _, path := range inputs {
+			format, n, err := limesub.ValidateFile(path, opts)
+			if err != nil {
+				fmt.Printf("❌ %s (%s): %v\n", filepath.Base(path), strings.ToUpper(format), err)
+				failed = true
+				continue
+			}
+			fmt.Printf("✅ %s (%s): %d blok\n", filepath.Base(path), strings.ToUpper(format), n)
+		}
+		if failed {
+			os.Exit(1)
+		}
+		return
+	}
+	if len(inputs) == 1 && inputs[0] == limesub.StdioPath {
+		if err := limesub.ProcessFile(limesub.StdioPath, opts); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	failed := processAll(inputs, opts, opts.Jobs)
+	summary := ""
+	if len(inputs) > 1 {
+		summary = fmt.Sprintf("%d file: %d berhasil, %d gagal", len(inputs), len(inputs)-len(failed), len(failed))
+		fmt.Println("📁", summary)
+		summary += "\n\n"
+	}
+	if len(failed) > 0 {
+		MessageBox("Limesub v3", summary+strings.Join(failed, "\n\n"))
+		os.Exit(1)
+	}
+}
+
+// processAll converts inputs with up to jobs of them in flight at once and
+// returns the failures as "name: error", in input order.
+func processAll(inputs []string, opts limesub.Options, jobs int) []string {
+	if jobs < 1 {
+		jobs = 1
+	}
+	errs := make([]error, len(inputs))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				errs[i] = limesub.ProcessFile(inputs[i], opts)
+			}
+		}()
+	}
+	for i := range inputs {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	var failed []string
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, filepath.Base(inputs[i])+": "+err.Error())
+		}
+	}
+	return failed
+}
@@ -0,0 +1,38 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+// ====================== MESSAGEBOX (LINUX/MACOS) ======================
+
+// MessageBox shows a dialog through osascript on macOS or zenity on a Linux
+// desktop, so dropping files onto the binary still reports back. Without
+// either, the message goes to stderr.
+func MessageBox(title, text string) {
+	if runtime.GOOS == "darwin" {
+		if path, err := exec.LookPath("osascript"); err == nil {
+			// text and title go in as arguments, no AppleScript quoting needed
+			cmd := exec.Command(path,
+				"-e", "on run argv",
+				"-e", `display dialog (item 1 of argv) with title (item 2 of argv) buttons {"OK"} default button 1`,
+				"-e", "end run",
+				text, title)
+			if cmd.Run() == nil {
+				return
+			}
+		}
+	} else if os.Getenv("DISPLAY") != "" || os.Getenv("WAYLAND_DISPLAY") != "" {
+		if path, err := exec.LookPath("zenity"); err == nil {
+			if exec.Command(path, "--info", "--no-markup", "--title", title, "--text", text).Run() == nil {
+				return
+			}
+		}
+	}
+	fmt.Fprintf(os.Stderr, "[%s] %s\n", title, text)
+}
@@ -0,0 +1,22 @@
+//go:build windows
+
+package main
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// ====================== MESSAGEBOX (WINDOWS) ======================
+
+var (
+	user32          = windows.NewLazySystemDLL("user32.dll")
+	procMessageBoxW = user32.NewProc("MessageBoxW")
+)
+
+func MessageBox(title, text string) {
+	titleUTF16, _ := windows.UTF16PtrFromString(title)
+	textUTF16, _ := windows.UTF16PtrFromString(text)
+	procMessageBoxW.Call(0, uintptr(unsafe.Pointer(textUTF16)), uintptr(unsafe.Pointer(titleUTF16)), 0)
+}